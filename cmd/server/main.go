@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"claude-web-go/internal/api"
+	"claude-web-go/internal/config"
+	"claude-web-go/internal/metrics"
+	"claude-web-go/internal/tracing"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 )
@@ -16,6 +24,11 @@ func main() {
 		port = "8080"
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	server, err := api.NewServer()
 	if err != nil {
 		log.Fatalf("Failed to create server: %v", err)
@@ -24,21 +37,99 @@ func main() {
 	router := mux.NewRouter()
 
 	router.HandleFunc("/api/chat", server.HandleChat).Methods("POST")
-	router.HandleFunc("/api/files/{sessionId}/{filename}", server.HandleFile).Methods("GET")
+	router.HandleFunc("/api/jobs", server.HandleCreateJob).Methods("POST")
+	router.HandleFunc("/api/jobs/{id}", server.HandleGetJob).Methods("GET")
+	router.HandleFunc("/api/jobs/{id}", server.HandleCancelJob).Methods("DELETE")
+	router.HandleFunc("/api/batches", server.HandleCreateBatch).Methods("POST")
+	router.HandleFunc("/api/batches/{id}", server.HandleGetBatch).Methods("GET")
+	router.HandleFunc("/api/batches/{id}", server.HandleCancelBatch).Methods("DELETE")
+	router.HandleFunc("/api/batches/{id}/results.zip", server.HandleBatchResults).Methods("GET")
+	router.HandleFunc("/api/webhooks", server.HandleCreateWebhook).Methods("POST")
+	router.HandleFunc("/api/webhooks", server.HandleListWebhooks).Methods("GET")
+	router.HandleFunc("/api/webhooks/{id}", server.HandleDeleteWebhook).Methods("DELETE")
+	router.HandleFunc("/api/webhooks/{id}/deliveries", server.HandleWebhookDeliveries).Methods("GET")
+	router.HandleFunc("/api/webhooks/{id}/test", server.HandleTestWebhook).Methods("POST")
+	router.HandleFunc("/api/schedules", server.HandleCreateSchedule).Methods("POST")
+	router.HandleFunc("/api/schedules", server.HandleListSchedules).Methods("GET")
+	router.HandleFunc("/api/schedules/{id}", server.HandleGetSchedule).Methods("GET")
+	router.HandleFunc("/api/schedules/{id}", server.HandleUpdateSchedule).Methods("PUT")
+	router.HandleFunc("/api/schedules/{id}", server.HandleDeleteSchedule).Methods("DELETE")
+	router.HandleFunc("/api/schedules/{id}/run", server.HandleRunSchedule).Methods("POST")
+	router.HandleFunc("/api/files/{sessionId}/{filename:.+}/versions", server.HandleVersions).Methods("GET")
+	router.HandleFunc("/api/files/{sessionId}/{filename:.+}/diff", server.HandleDiff).Methods("GET")
+	router.HandleFunc("/api/files/{sessionId}/{filename:.+}", server.HandleFile).Methods("GET")
+	router.HandleFunc("/api/sessions/{sessionId}/files", server.HandleListFiles).Methods("GET")
+	router.HandleFunc("/api/sessions/{sessionId}/files.zip", server.HandleArchive).Methods("GET")
+	router.HandleFunc("/api/sessions/{sessionId}/jobs", server.HandleListSessionJobs).Methods("GET")
 	router.HandleFunc("/api/ws", server.HandleWebSocket)
+	router.HandleFunc("/api/health", server.HandleHealth).Methods("GET")
+	router.HandleFunc("/api/admin/diagnostics", server.HandleDiagnostics).Methods("GET")
+	router.HandleFunc("/healthz", server.HandleLiveness).Methods("GET")
+	router.HandleFunc("/readyz", server.HandleReadiness).Methods("GET")
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
 	
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./web/")))
+	router.Use(api.Instrument)
 
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{"X-Request-ID"},
 	})
 
-	handler := c.Handler(router)
+	handler := c.Handler(api.SecurityHeaders(api.RequestID(api.Identify(router))))
+
+	// Requests run in their own context, so work still going when the
+	// shutdown deadline passes can be cancelled.
+	requests, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+
+	httpServer := &http.Server{
+		Addr:        ":" + port,
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return requests },
+	}
+	httpServer.RegisterOnShutdown(server.DrainWebSockets)
+
+	signals, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	log.Printf("Server starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, handler); err != nil {
+	served := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		served <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-served:
 		log.Fatal(err)
+	case <-signals.Done():
+	}
+	stop()
+	log.Printf("Shutting down")
+
+	drain, cancel := context.WithTimeout(context.Background(), config.Duration("SHUTDOWN_TIMEOUT", 30*time.Second))
+	defer cancel()
+	if err := httpServer.Shutdown(drain); err != nil {
+		log.Printf("Requests still running at the shutdown deadline: %v", err)
+	}
+	if err := server.Shutdown(drain); err != nil {
+		log.Printf("Shutdown deadline passed: %v", err)
+	}
+	// Anything left, such as a chat request or a WebSocket message, is
+	// cancelled too; give it a moment to be answered.
+	cancelRequests()
+	closing, cancelClosing := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelClosing()
+	if err := httpServer.Shutdown(closing); err != nil {
+		httpServer.Close()
+	}
+
+	// Flush buffered spans last, so the shutdown's own are included.
+	flush, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flush); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
 	}
-}
\ No newline at end of file
+}
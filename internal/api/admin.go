@@ -0,0 +1,154 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-web-go/internal/auth"
+	"claude-web-go/internal/claude"
+	"claude-web-go/internal/models"
+)
+
+// adminAccess decides who may use the admin endpoints: callers presenting
+// ADMIN_TOKEN as a bearer token, and callers the authenticating proxy puts
+// in one of the comma-separated ADMIN_GROUPS. With neither set the
+// endpoints are disabled.
+type adminAccess struct {
+	token  string
+	groups map[string]bool
+}
+
+func adminAccessFromEnv() adminAccess {
+	access := adminAccess{
+		token:  os.Getenv("ADMIN_TOKEN"),
+		groups: make(map[string]bool),
+	}
+	for _, group := range strings.Split(os.Getenv("ADMIN_GROUPS"), ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			access.groups[group] = true
+		}
+	}
+	return access
+}
+
+// authorize reports whether r may use the admin endpoints, writing the
+// error response when it may not.
+func (a adminAccess) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if a.token == "" && len(a.groups) == 0 {
+		writeJSON(w, http.StatusForbidden, models.ErrorResponse{
+			Error: "Admin endpoints are disabled.",
+		})
+		return false
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && a.token != "" {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1 {
+			return true
+		}
+	}
+	if identity := auth.IdentityFromContext(r.Context()); identity != nil {
+		for _, group := range identity.Groups {
+			if a.groups[group] {
+				return true
+			}
+		}
+		writeJSON(w, http.StatusForbidden, models.ErrorResponse{
+			Error: "Admin access required.",
+		})
+		return false
+	}
+
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	writeJSON(w, http.StatusUnauthorized, models.ErrorResponse{
+		Error: "Admin access required.",
+	})
+	return false
+}
+
+// HandleDiagnostics reports everything the health endpoints check, in
+// detail, plus the claude CLI version, job queue and file store usage.
+// With probe=true it also runs a live prompt through the profile named by
+// profile, or the default one; that costs a model call.
+func (s *Server) HandleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	if !s.admin.authorize(w, r) {
+		return
+	}
+
+	response := models.DiagnosticsResponse{
+		ReadinessResponse: s.readiness(),
+		StartedAt:         s.startedAt,
+		Uptime:            time.Since(s.startedAt).Round(time.Second).String(),
+		GoVersion:         runtime.Version(),
+		Providers:         make(map[string]models.CredentialHealth),
+		Backends:          make(map[string]models.BackendHealth),
+		Jobs:              models.JobsHealth{MaxQueued: s.maxQueuedJobs},
+	}
+
+	path, version, err := s.executor.CLIVersion(r.Context())
+	response.CLI = models.CLIHealth{Path: path, Version: version}
+	if err != nil {
+		response.CLI.Error = err.Error()
+	}
+
+	for name, status := range s.executor.ProviderStatus() {
+		credentials := models.CredentialHealth{
+			Valid:       status.Valid,
+			ExpiresAt:   status.Expiration,
+			LastRefresh: status.LastRefresh,
+		}
+		if !status.Expiration.IsZero() {
+			credentials.ExpiresIn = time.Until(status.Expiration).Round(time.Second).String()
+		}
+		if status.LastError != nil {
+			credentials.LastError = status.LastError.Error()
+		}
+		response.Providers[name] = credentials
+	}
+	for name, breaker := range s.executor.BreakerStatus() {
+		backend := models.BackendHealth{
+			Breaker:             string(breaker.State),
+			ConsecutiveFailures: breaker.ConsecutiveFailures,
+		}
+		if breaker.State != claude.BreakerClosed {
+			retryAt := breaker.RetryAt
+			backend.RetryAt = &retryAt
+		}
+		response.Backends[name] = backend
+	}
+
+	response.Jobs.Queued, response.Jobs.Background, response.Jobs.Running = s.jobs.Stats()
+	response.FileStore.Sessions, response.FileStore.Bytes = s.fileManager.Usage()
+
+	if probe, _ := strconv.ParseBool(r.URL.Query().Get("probe")); probe {
+		result, err := s.executor.Probe(r.Context(), r.URL.Query().Get("profile"))
+		if err != nil {
+			execErr := claude.AsExecutionError(err)
+			writeJSON(w, errorStatus(execErr.Code), models.ErrorResponse{
+				Error:     execErr.Message,
+				ErrorCode: string(execErr.Code),
+			})
+			return
+		}
+		response.Probe = &models.ProbeHealth{
+			OK:       result.Err == nil,
+			Profile:  result.Profile,
+			Provider: result.Provider,
+			Model:    result.Model,
+			Duration: result.Duration.Round(time.Millisecond).String(),
+			Output:   result.Output,
+			CostUSD:  result.CostUSD,
+		}
+		if result.Err != nil {
+			// Unlike chat errors, admins get the details.
+			response.Probe.Error = result.Err.Error()
+			response.Probe.ErrorCode = string(result.Err.Code)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
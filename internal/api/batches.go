@@ -0,0 +1,217 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"claude-web-go/internal/claude"
+	"claude-web-go/internal/jobs"
+	"claude-web-go/internal/logger"
+	"claude-web-go/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// maxBatchUpload bounds the size of a batch request, uploads included.
+const maxBatchUpload = 10 << 20
+
+// HandleCreateBatch queues a batch. The body is either a JSON
+// BatchRequest, or a multipart form with "template", optional "profile" and
+// "timeoutSeconds" fields, and an "items" file holding a CSV with a header
+// row or a JSON array of objects.
+func (s *Server) HandleCreateBatch(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchUpload)
+
+	req, err := parseBatchRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{
+			Error:     err.Error(),
+			ErrorCode: string(claude.ErrInvalidRequest),
+		})
+		return
+	}
+
+	batch, err := s.jobs.SubmitBatch(r.Context(), req)
+	if errors.Is(err, jobs.ErrInvalidBatch) {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{
+			Error:     err.Error(),
+			ErrorCode: string(claude.ErrInvalidRequest),
+		})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, models.ErrorResponse{
+			Error:     "The batch could not be queued.",
+			ErrorCode: string(claude.ErrInternal),
+		})
+		return
+	}
+
+	w.Header().Set("Location", "/api/batches/"+batch.ID)
+	writeJSON(w, http.StatusAccepted, batch)
+}
+
+func (s *Server) HandleGetBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := s.jobs.Batch(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "Batch not found."})
+		return
+	}
+	writeJSON(w, http.StatusOK, batch)
+}
+
+// HandleCancelBatch cancels the items of a batch that haven't finished.
+func (s *Server) HandleCancelBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := s.jobs.CancelBatch(r.Context(), mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "Batch not found."})
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: "The batch could not be cancelled."})
+	default:
+		writeJSON(w, http.StatusAccepted, batch)
+	}
+}
+
+// HandleBatchResults streams a zip holding results.json, with every item's
+// variables, status and output, and each item's files under item-NNN/.
+// Items that haven't finished are included with their current status.
+func (s *Server) HandleBatchResults(w http.ResponseWriter, r *http.Request) {
+	batch, err := s.jobs.Batch(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "Batch not found."})
+		return
+	}
+
+	results := make([]models.BatchResult, 0, len(batch.Items))
+	for _, item := range batch.Items {
+		result := models.BatchResult{BatchItem: item, Files: []string{}}
+		job, err := s.jobs.Get(r.Context(), item.JobID)
+		if err == nil && job.Response != nil {
+			result.Output = job.Response.Message.Content
+			for _, file := range job.Response.Files {
+				result.Files = append(result.Files, itemPrefix(item)+file.Name)
+			}
+		}
+		results = append(results, result)
+	}
+
+	archiveName := fmt.Sprintf("batch-%s-results.zip", shortID(batch.ID))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archiveName}))
+
+	log := logger.FromContext(r.Context()).WithField("batchID", batch.ID)
+	archive := zip.NewWriter(w)
+	entry, err := archive.Create("results.json")
+	if err == nil {
+		encoder := json.NewEncoder(entry)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(results)
+	}
+	if err != nil {
+		// Headers are already sent, so the client sees a truncated archive.
+		log.WithError(err).Error("Failed to stream batch results")
+		return
+	}
+
+	for _, result := range results {
+		if len(result.Files) == 0 {
+			continue
+		}
+		// Files expire with their job or a restart; results.json still lists
+		// them.
+		if err := s.fileManager.AddToArchive(archive, result.SessionID, itemPrefix(result.BatchItem)); err != nil {
+			log.WithError(err).WithField("item", result.Index).Warn("Failed to add batch item files to archive")
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.WithError(err).Error("Failed to stream batch results")
+	}
+}
+
+func itemPrefix(item models.BatchItem) string {
+	return fmt.Sprintf("item-%03d/", item.Index)
+}
+
+func parseBatchRequest(r *http.Request) (models.BatchRequest, error) {
+	var req models.BatchRequest
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, errors.New("the request body is not valid JSON")
+		}
+		return req, nil
+	}
+
+	if err := r.ParseMultipartForm(maxBatchUpload); err != nil {
+		return req, errors.New("the request body is not a valid form")
+	}
+	req.Template = r.FormValue("template")
+	req.Profile = r.FormValue("profile")
+	if value := r.FormValue("timeoutSeconds"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			return req, errors.New("timeoutSeconds must be a number")
+		}
+		req.TimeoutSeconds = seconds
+	}
+
+	file, header, err := r.FormFile("items")
+	if err != nil {
+		return req, errors.New("the items file is missing")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return req, errors.New("the items file could not be read")
+	}
+	req.Items, err = parseBatchItems(header.Filename, data)
+	return req, err
+}
+
+// parseBatchItems reads variable sets from a JSON array of objects of
+// strings, or from a CSV whose header row names the variables.
+func parseBatchItems(filename string, data []byte) ([]map[string]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	trimmed := bytes.TrimSpace(data)
+
+	if strings.HasSuffix(strings.ToLower(filename), ".json") || bytes.HasPrefix(trimmed, []byte("[")) {
+		var items []map[string]string
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, errors.New("the items file must be a JSON array of objects with string values")
+		}
+		return items, nil
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("the items file is not valid CSV: %w", err)
+	}
+	if len(records) < 2 {
+		return nil, errors.New("the items CSV needs a header row and at least one row")
+	}
+
+	header := records[0]
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	items := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		item := make(map[string]string, len(header))
+		for i, name := range header {
+			item[name] = record[i]
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
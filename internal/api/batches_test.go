@@ -0,0 +1,116 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"claude-web-go/internal/claude"
+	"claude-web-go/internal/jobs"
+	"claude-web-go/internal/models"
+	"claude-web-go/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+func TestBatchResultsOutliveFileStoreTTL(t *testing.T) {
+	t.Setenv("JOBS_DIR", t.TempDir())
+	const ttl = 50 * time.Millisecond
+
+	s := &Server{fileManager: storage.NewFileManager(ttl)}
+	output := t.TempDir()
+	var err error
+	s.jobs, err = jobs.NewManager(
+		func(ctx context.Context, req models.ChatRequest) models.ChatResponse {
+			path := filepath.Join(output, req.SessionID+".txt")
+			if err := os.WriteFile(path, []byte("report for "+req.Message), 0644); err != nil {
+				t.Error(err)
+			}
+			result := &claude.Result{
+				Output: "done",
+				Files:  []models.File{{Name: "report.txt", Path: path}},
+				Status: models.StatusCompleted,
+			}
+			return s.jobResponse(ctx, req, result, nil)
+		},
+		func(owner string, job models.Job, webhook *models.Webhook) {},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := s.jobs.SubmitBatch(context.Background(), models.BatchRequest{
+		Template: "Summarize {{name}}",
+		Items:    []map[string]string{{"name": "first"}, {"name": "second"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file store lives outside the test's directories.
+	for _, item := range batch.Items {
+		t.Cleanup(func() { os.RemoveAll(filepath.Join("/tmp/claude-web", item.SessionID)) })
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for batch.Counts[models.JobCompleted] < len(batch.Items) {
+		if time.Now().After(deadline) {
+			t.Fatalf("batch did not finish: %+v", batch.Counts)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if batch, err = s.jobs.Batch(context.Background(), batch.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A chat session stored now expires with the TTL; the batch's don't.
+	chat := filepath.Join(output, "chat.txt")
+	if err := os.WriteFile(chat, []byte("chat"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chatSession := "chat-" + batch.ID
+	t.Cleanup(func() { os.RemoveAll(filepath.Join("/tmp/claude-web", chatSession)) })
+	if _, err := s.fileManager.StoreFile(context.Background(), chatSession, chat, "chat.txt"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * ttl)
+	if _, err := s.fileManager.ListFiles(chatSession); err == nil {
+		t.Fatal("chat session outlived the TTL, want it removed")
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/api/batches/"+batch.ID+"/results.zip", nil), map[string]string{"id": batch.ID})
+	rec := httptest.NewRecorder()
+	s.HandleBatchResults(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := make(map[string]string)
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[f.Name] = string(data)
+	}
+	if got := contents["item-001/report.txt"]; got != "report for Summarize first" {
+		t.Errorf("item-001/report.txt = %q, want the first item's report; archive has %d entries", got, len(contents))
+	}
+	if got := contents["item-002/report.txt"]; got != "report for Summarize second" {
+		t.Errorf("item-002/report.txt = %q, want the second item's report", got)
+	}
+}
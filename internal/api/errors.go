@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"claude-web-go/internal/claude"
+)
+
+// statusClientClosedRequest is the non-standard status for requests the
+// client gave up on; nobody reads it, but it keeps them apart in access
+// logs.
+const statusClientClosedRequest = 499
+
+// errorStatus maps an execution error code to an HTTP status.
+func errorStatus(code claude.ErrorCode) int {
+	switch code {
+	case claude.ErrInvalidRequest:
+		return http.StatusBadRequest
+	case claude.ErrContextTooLong:
+		return http.StatusRequestEntityTooLarge
+	case claude.ErrThrottled:
+		return http.StatusTooManyRequests
+	case claude.ErrAuthExpired, claude.ErrUnavailable, claude.ErrCLIMissing, claude.ErrServiceDegraded:
+		return http.StatusServiceUnavailable
+	case claude.ErrModelNotEnabled, claude.ErrPermissionDenied, claude.ErrToolError:
+		return http.StatusBadGateway
+	case claude.ErrTimeout:
+		return http.StatusGatewayTimeout
+	case claude.ErrCancelled:
+		return statusClientClosedRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"claude-web-go/internal/logger"
+	"claude-web-go/internal/models"
+	"claude-web-go/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// HandleListFiles lists every file stored for a session. Each file's path
+// is the URL it can be fetched from.
+func (s *Server) HandleListFiles(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["sessionId"]
+
+	stored, err := s.fileManager.ListFiles(sessionID)
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	response := models.SessionFilesResponse{
+		SessionID: sessionID,
+		Files:     make([]models.File, 0, len(stored)),
+	}
+	for _, file := range stored {
+		var versionID string
+		if len(file.Versions) > 0 {
+			versionID = file.Versions[len(file.Versions)-1].ID
+		}
+		response.Files = append(response.Files, models.File{
+			Name:        file.Name,
+			Path:        fileURL(sessionID, file.Name),
+			MimeType:    file.MimeType,
+			Size:        file.Size,
+			Previewable: file.Previewable,
+			Language:    file.Language,
+			Version:     versionID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleArchive streams a zip of the session's files. Repeating the "file"
+// query parameter restricts the archive to those files.
+func (s *Server) HandleArchive(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["sessionId"]
+	names := r.URL.Query()["file"]
+
+	// Resolve the selection before committing to a 200 response.
+	if _, err := s.fileManager.ListFiles(sessionID); err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	for _, name := range names {
+		if _, err := s.fileManager.GetFile(sessionID, name); err != nil {
+			http.Error(w, "File not found: "+name, http.StatusNotFound)
+			return
+		}
+	}
+
+	archiveName := fmt.Sprintf("session-%s-files.zip", shortID(sessionID))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archiveName}))
+
+	if err := s.fileManager.WriteArchive(w, sessionID, names); err != nil {
+		// Headers are already sent, so the client sees a truncated archive.
+		logger.FromContext(r.Context()).WithError(err).WithField("sessionID", sessionID).Error("Failed to stream archive")
+	}
+}
+
+// HandleVersions lists every stored version of a file, oldest first.
+func (s *Server) HandleVersions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sessionID := vars["sessionId"]
+	filename := vars["filename"]
+
+	versions, err := s.fileManager.ListVersions(sessionID, filename)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	response := models.FileVersionsResponse{
+		SessionID: sessionID,
+		Name:      filename,
+		Versions:  make([]models.FileVersion, 0, len(versions)),
+	}
+	for _, version := range versions {
+		response.Versions = append(response.Versions, models.FileVersion{
+			ID:       version.ID,
+			URL:      fileURL(sessionID, filename) + "?version=" + version.ID,
+			MimeType: version.MimeType,
+			Size:     version.Size,
+			StoredAt: version.StoredAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleDiff returns a unified diff between two versions of a text file.
+// "from" defaults to the version before "to", and "to" to the latest.
+func (s *Server) HandleDiff(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	diff, err := s.fileManager.Diff(vars["sessionId"], vars["filename"], query.Get("from"), query.Get("to"))
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, storage.ErrNotText):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	case errors.Is(err, storage.ErrTooLargeToDiff):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, storage.ErrNoEarlier):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Error computing diff", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	io.WriteString(w, diff)
+}
+
+func fileURL(sessionID, name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/api/files/" + url.PathEscape(sessionID) + "/" + strings.Join(segments, "/")
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
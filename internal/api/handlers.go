@@ -1,26 +1,58 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
+	"mime"
 	"net/http"
 	"os"
-	"path/filepath"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"claude-web-go/internal/claude"
+	"claude-web-go/internal/config"
+	"claude-web-go/internal/filetype"
+	"claude-web-go/internal/jobs"
+	"claude-web-go/internal/logger"
 	"claude-web-go/internal/models"
+	"claude-web-go/internal/scheduler"
 	"claude-web-go/internal/storage"
+	"claude-web-go/internal/tracing"
+	"claude-web-go/internal/webhooks"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Server struct {
 	executor    *claude.Executor
 	fileManager *storage.FileManager
+	jobs        *jobs.Manager
+	webhooks    *webhooks.Dispatcher
+	scheduler   *scheduler.Scheduler
 	upgrader    websocket.Upgrader
+
+	admin         adminAccess
+	startedAt     time.Time
+	maxQueuedJobs int
+	// ready is the outcome of the last readiness check.
+	ready atomic.Bool
+
+	// sockets holds the open WebSocket connections and whether each is
+	// running a message.
+	socketsMu   sync.Mutex
+	sockets     map[*websocket.Conn]bool
+	socketsOpen sync.WaitGroup
+	draining    bool
 }
 
 func NewServer() (*Server, error) {
@@ -29,7 +61,7 @@ func NewServer() (*Server, error) {
 		return nil, fmt.Errorf("failed to create executor: %w", err)
 	}
 
-	return &Server{
+	s := &Server{
 		executor:    executor,
 		fileManager: storage.NewFileManager(30 * time.Minute),
 		upgrader: websocket.Upgrader{
@@ -37,13 +69,38 @@ func NewServer() (*Server, error) {
 				return true
 			},
 		},
-	}, nil
+		sockets:       make(map[*websocket.Conn]bool),
+		admin:         adminAccessFromEnv(),
+		startedAt:     time.Now(),
+		maxQueuedJobs: config.Int("READY_MAX_QUEUED_JOBS", defaultMaxQueuedJobs),
+	}
+
+	s.webhooks, err = webhooks.NewDispatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook dispatcher: %w", err)
+	}
+
+	s.scheduler, err = scheduler.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scheduler: %w", err)
+	}
+
+	s.jobs, err = jobs.NewManager(s.runJob, s.notifyJob)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job manager: %w", err)
+	}
+	s.scheduler.Start(s.jobs)
+
+	return s, nil
 }
 
 func (s *Server) HandleChat(w http.ResponseWriter, r *http.Request) {
 	var req models.ChatRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeJSON(w, http.StatusBadRequest, models.ChatResponse{
+			Error:     "The request body is not valid JSON.",
+			ErrorCode: string(claude.ErrInvalidRequest),
+		})
 		return
 	}
 
@@ -51,41 +108,49 @@ func (s *Server) HandleChat(w http.ResponseWriter, r *http.Request) {
 		req.SessionID = uuid.New().String()
 	}
 
-	output, files, err := s.executor.Execute(req.Message, req.ContextWindow)
-	
-	response := models.ChatResponse{
-		SessionID: req.SessionID,
-		Message: models.Message{
-			ID:        uuid.New().String(),
-			Role:      "assistant",
-			Content:   output,
-			Timestamp: time.Now(),
-		},
-	}
-
-	if err != nil {
-		response.Error = err.Error()
-	}
+	result, err := s.executor.Execute(r.Context(), req)
+	response := s.buildResponse(r.Context(), req.SessionID, result, err)
+	s.notifyMessage(r.Context(), response)
 
-	if len(files) > 0 {
-		for _, file := range files {
-			if err := s.fileManager.StoreFile(req.SessionID, file.Path, file.Name); err == nil {
-				response.Files = append(response.Files, file)
-			}
+	// A timed-out run still answers the request, with partial output.
+	status := http.StatusOK
+	if err != nil && response.Status != models.StatusTimedOut {
+		execErr := claude.AsExecutionError(err)
+		status = errorStatus(execErr.Code)
+		if execErr.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(execErr.RetryAfter.Seconds()))))
 		}
-		response.Message.Files = response.Files
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, status, response)
 }
 
+// HandleFile serves a stored file. "version" selects a specific version,
+// and "size=thumb|medium" or "format=png" a scaled or rasterized rendition
+// of an image.
 func (s *Server) HandleFile(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	sessionID := vars["sessionId"]
 	filename := vars["filename"]
 
-	filePath, err := s.fileManager.GetFile(sessionID, filename)
+	query := r.URL.Query()
+	versionID := query.Get("version")
+
+	rendition := query.Get("size")
+	if rendition == "" && query.Get("format") == "png" {
+		rendition = storage.RenditionPNG
+	}
+	if rendition != "" {
+		s.serveRendition(w, sessionID, filename, versionID, rendition)
+		return
+	}
+
+	var filePath string
+	var err error
+	if versionID != "" {
+		filePath, err = s.fileManager.GetFileVersion(sessionID, filename, versionID)
+	} else {
+		filePath, err = s.fileManager.GetFile(sessionID, filename)
+	}
 	if err != nil {
 		http.Error(w, "File not found", http.StatusNotFound)
 		return
@@ -98,67 +163,188 @@ func (s *Server) HandleFile(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	mimeType := getMimeType(filename)
-	w.Header().Set("Content-Type", mimeType)
-	w.Header().Set("Content-Disposition", "inline; filename=\""+filename+"\"")
+	// Stored objects are named by hash, so the type comes from the
+	// requested name plus the content.
+	head := make([]byte, filetype.SniffLen)
+	n, _ := io.ReadFull(file, head)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+	fileType := filetype.Detect(filename, head[:n])
+
+	mimeType := fileType.MimeType
+	if fileType.Text {
+		w.Header().Set("Content-Type", mimeType+"; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", mimeType)
+	}
+	// Files that can't be previewed, including XML that would render as
+	// SVG or XHTML, are only offered for download.
+	disposition := "inline"
+	if !fileType.Previewable {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": path.Base(filename)}))
+	if csp := contentSecurityPolicy(mimeType); csp != "" {
+		w.Header().Set("Content-Security-Policy", csp)
+	}
+	if versionID != "" {
+		// Versions are content-addressed and never change.
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	}
 	
 	io.Copy(w, file)
 }
 
+func (s *Server) serveRendition(w http.ResponseWriter, sessionID, filename, versionID, rendition string) {
+	switch rendition {
+	case storage.RenditionThumb, storage.RenditionMedium, storage.RenditionPNG:
+	default:
+		http.Error(w, "size must be thumb or medium", http.StatusBadRequest)
+		return
+	}
+
+	filePath, mimeType, err := s.fileManager.GetRendition(sessionID, filename, versionID, rendition)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	name := strings.TrimSuffix(path.Base(filename), path.Ext(filename)) + ".png"
+	if mimeType == "image/jpeg" {
+		name = strings.TrimSuffix(name, ".png") + ".jpg"
+	}
+
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name}))
+	if versionID != "" {
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	}
+
+	io.Copy(w, file)
+}
+
 func (s *Server) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
 	}
 	defer conn.Close()
+	if !s.openSocket(conn) {
+		return
+	}
+	defer s.closeSocket(conn)
+
+	// Each message gets its own trace, linked to the connection's.
+	tracer := tracing.Tracer("api")
+	connection := trace.LinkFromContext(r.Context())
 
 	for {
 		var req models.ChatRequest
 		if err := conn.ReadJSON(&req); err != nil {
 			break
 		}
+		s.socketBusy(conn, true)
 
-		output, files, err := s.executor.Execute(req.Message, req.ContextWindow)
-		
-		response := models.ChatResponse{
-			SessionID: req.SessionID,
-			Message: models.Message{
-				ID:        uuid.New().String(),
-				Role:      "assistant",
-				Content:   output,
-				Timestamp: time.Now(),
-			},
-		}
+		ctx, span := tracer.Start(r.Context(), "websocket message",
+			trace.WithNewRoot(),
+			trace.WithLinks(connection),
+		)
+		ctx = logger.WithContext(ctx, logger.FromContext(ctx).WithField("traceID", tracing.TraceID(ctx)))
+		result, err := s.executor.Execute(ctx, req)
+		response := s.buildResponse(ctx, req.SessionID, result, err)
+		s.notifyMessage(ctx, response)
+		span.End()
 
-		if err != nil {
-			response.Error = err.Error()
+		if err := conn.WriteJSON(response); err != nil {
+			break
 		}
-
-		if len(files) > 0 {
-			for _, file := range files {
-				if err := s.fileManager.StoreFile(req.SessionID, file.Path, file.Name); err == nil {
-					response.Files = append(response.Files, file)
-				}
-			}
-			response.Message.Files = response.Files
+		if !s.socketBusy(conn, false) {
+			break
 		}
+	}
+}
 
-		if err := conn.WriteJSON(response); err != nil {
-			break
+// buildResponse turns an execution result into a ChatResponse, copying any
+// generated files into the session's file store.
+func (s *Server) buildResponse(ctx context.Context, sessionID string, result *claude.Result, err error) models.ChatResponse {
+	response := models.ChatResponse{
+		SessionID: sessionID,
+		Message: models.Message{
+			ID:        uuid.New().String(),
+			Role:      "assistant",
+			Timestamp: time.Now(),
+		},
+		TraceID: tracing.TraceID(ctx),
+	}
+
+	if err != nil {
+		// The full error has been logged by the executor; users only get
+		// the safe message.
+		execErr := claude.AsExecutionError(err)
+		response.Error = execErr.Message
+		response.ErrorCode = string(execErr.Code)
+		response.Retryable = execErr.Retryable
+	}
+
+	if result == nil {
+		return response
+	}
+
+	response.Message.Content = result.Output
+	response.Skipped = result.Skipped
+	response.Status = result.Status
+	if result.Metadata.Provider != "" {
+		metadata := result.Metadata
+		response.Metadata = &metadata
+	}
+
+	if len(result.Files) > 0 {
+		ctx, span := tracing.Tracer("api").Start(ctx, "storage.store_files", trace.WithAttributes(
+			attribute.Int("files.count", len(result.Files)),
+		))
+		defer span.End()
+
+		for _, file := range result.Files {
+			version, err := s.fileManager.StoreFile(ctx, sessionID, file.Path, file.Name)
+			if err != nil {
+				logger.FromContext(ctx).WithError(err).WithField("filename", file.Name).Warn("Failed to store output file")
+			} else {
+				// Link the message to the exact content it produced, so a
+				// later regeneration doesn't change what it shows.
+				file.Version = version.ID
+				response.Files = append(response.Files, file)
+			}
 		}
+		response.Message.Files = response.Files
 	}
+
+	return response
 }
 
-func getMimeType(filename string) string {
-	ext := filepath.Ext(filename)
-	switch ext {
-	case ".png":
-		return "image/png"
-	case ".svg":
-		return "image/svg+xml"
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
+// contentSecurityPolicy returns the policy for generated documents served
+// inline. Anything a browser might render as a document, including XML it
+// could style with XSLT or treat as SVG or XHTML, is sandboxed: the
+// sandbox directive puts it in an opaque origin so it cannot reach the
+// app's cookies or localStorage, and scripts don't run. Raster images have
+// nothing to run, and PDF viewers refuse to open sandboxed documents.
+func contentSecurityPolicy(mimeType string) string {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf":
+		return ""
+	case "text/html":
+		return "sandbox; default-src 'none'; img-src data:; style-src 'unsafe-inline'; font-src data:"
+	case "image/svg+xml":
+		return "sandbox; default-src 'none'; img-src data:; style-src 'unsafe-inline'"
 	default:
-		return "application/octet-stream"
+		return "sandbox; default-src 'none'"
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"claude-web-go/internal/claude"
+	"claude-web-go/internal/logger"
+	"claude-web-go/internal/models"
+)
+
+// credentialWarning is how close to expiry credentials are reported as
+// degraded; the background refresher should have renewed them well before.
+const credentialWarning = 15 * time.Minute
+
+// defaultMaxQueuedJobs is how many submitted jobs may wait for a worker
+// before the instance stops accepting traffic.
+const defaultMaxQueuedJobs = 100
+
+// HandleHealth reports whether the server can currently run claude. It
+// returns 503 once the cached credentials have expired, and reports
+// degraded while credentials are about to expire or a backend's circuit
+// breaker is open.
+func (s *Server) HandleHealth(w http.ResponseWriter, r *http.Request) {
+	status := s.executor.CredentialStatus()
+
+	response := models.HealthResponse{
+		Status: "ok",
+		Credentials: models.CredentialHealth{
+			Valid:       status.Valid,
+			ExpiresAt:   status.Expiration,
+			LastRefresh: status.LastRefresh,
+		},
+	}
+	if !status.Expiration.IsZero() {
+		response.Credentials.ExpiresIn = time.Until(status.Expiration).Round(time.Second).String()
+	}
+	if status.LastError != nil {
+		response.Credentials.LastError = status.LastError.Error()
+	}
+
+	breakerOpen := false
+	response.Backends = make(map[string]models.BackendHealth)
+	for name, breaker := range s.executor.BreakerStatus() {
+		backend := models.BackendHealth{
+			Breaker:             string(breaker.State),
+			ConsecutiveFailures: breaker.ConsecutiveFailures,
+		}
+		if breaker.State != claude.BreakerClosed {
+			retryAt := breaker.RetryAt
+			backend.RetryAt = &retryAt
+			breakerOpen = true
+		}
+		response.Backends[name] = backend
+	}
+
+	// An open breaker is reported as degraded rather than unhealthy: the
+	// backend is shared, so taking this instance out of rotation wouldn't
+	// help.
+	code := http.StatusOK
+	switch {
+	case !status.Valid:
+		response.Status = "unhealthy"
+		code = http.StatusServiceUnavailable
+	case status.LastError != nil,
+		!status.Expiration.IsZero() && time.Until(status.Expiration) < credentialWarning,
+		breakerOpen:
+		response.Status = "degraded"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleLiveness reports that the process is up and serving requests. It
+// checks nothing else, so a failing dependency never gets the process
+// restarted.
+func (s *Server) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// HandleReadiness reports whether the instance can serve chat requests:
+// the claude CLI is installed, every provider's credentials are valid,
+// storage is writable and the job queue isn't saturated. It returns 503
+// otherwise, so load balancers route around the instance.
+func (s *Server) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	response := s.readiness()
+
+	code := http.StatusOK
+	if response.Status != "ready" {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, response)
+}
+
+// readiness runs the readiness checks, logging when the outcome changes.
+func (s *Server) readiness() models.ReadinessResponse {
+	checks := map[string]error{
+		"cli":         s.executor.CheckCLI(),
+		"credentials": s.checkCredentials(),
+		"storage":     s.checkStorage(),
+		"jobs":        s.checkQueue(),
+	}
+
+	response := models.ReadinessResponse{
+		Status: "ready",
+		Checks: make(map[string]models.ReadinessCheck, len(checks)),
+	}
+	failed := make(map[string]interface{})
+	for name, err := range checks {
+		check := models.ReadinessCheck{OK: err == nil}
+		if err != nil {
+			check.Error = err.Error()
+			failed[name] = check.Error
+			response.Status = "not_ready"
+		}
+		response.Checks[name] = check
+	}
+
+	if ready := len(failed) == 0; s.ready.Swap(ready) != ready {
+		if ready {
+			logger.Log.Info("Instance is ready")
+		} else {
+			logger.Log.WithFields(failed).Warn("Instance is not ready")
+		}
+	}
+	return response
+}
+
+func (s *Server) checkCredentials() error {
+	statuses := s.executor.ProviderStatus()
+	names := make([]string, 0, len(statuses))
+	for name := range statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		status := statuses[name]
+		switch {
+		case !status.Expiration.IsZero() && !time.Now().Before(status.Expiration):
+			return fmt.Errorf("%s credentials have expired", name)
+		case !status.Valid:
+			return fmt.Errorf("%s credentials are missing or invalid", name)
+		}
+	}
+	return nil
+}
+
+func (s *Server) checkStorage() error {
+	if err := s.executor.CheckWorkDir(); err != nil {
+		return err
+	}
+	if err := s.fileManager.CheckWritable(); err != nil {
+		return err
+	}
+	return s.jobs.CheckWritable()
+}
+
+func (s *Server) checkQueue() error {
+	// Batch items and schedule runs are the server's own backlog; only
+	// jobs submitted one by one say whether callers should go elsewhere.
+	if queued, _, _ := s.jobs.Stats(); queued >= s.maxQueuedJobs {
+		return fmt.Errorf("%d jobs are waiting for a worker", queued)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"claude-web-go/internal/claude"
+	"claude-web-go/internal/jobs"
+	"claude-web-go/internal/models"
+	"claude-web-go/internal/webhooks"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// runJob is the jobs.Runner: it executes a queued request the same way
+// HandleChat does.
+func (s *Server) runJob(ctx context.Context, req models.ChatRequest) models.ChatResponse {
+	result, err := s.executor.Execute(ctx, req)
+	return s.jobResponse(ctx, req, result, err)
+}
+
+// jobResponse builds a job's response. The job's files are kept as long as
+// the job, rather than the file store's TTL, since the job and its batch
+// results link to them.
+func (s *Server) jobResponse(ctx context.Context, req models.ChatRequest, result *claude.Result, err error) models.ChatResponse {
+	response := s.buildResponse(ctx, req.SessionID, result, err)
+	s.fileManager.Retain(req.SessionID, s.jobs.Retention())
+	return response
+}
+
+// HandleCreateJob queues a chat request and returns the job at once; the
+// result is fetched with HandleGetJob, or pushed to the webhook given with
+// the request.
+func (s *Server) HandleCreateJob(w http.ResponseWriter, r *http.Request) {
+	var req models.JobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{
+			Error:     "The request body is not valid JSON.",
+			ErrorCode: string(claude.ErrInvalidRequest),
+		})
+		return
+	}
+
+	var webhook *models.Webhook
+	if req.Webhook != nil {
+		var err error
+		webhook, err = webhooks.NewJobWebhook(r.Context(), *req.Webhook)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, models.ErrorResponse{
+				Error:     err.Error(),
+				ErrorCode: string(claude.ErrInvalidRequest),
+			})
+			return
+		}
+	}
+
+	if req.SessionID == "" {
+		req.SessionID = uuid.New().String()
+	}
+
+	job, err := s.jobs.Submit(r.Context(), req.ChatRequest, webhook)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, models.ErrorResponse{
+			Error:     "The job could not be queued.",
+			ErrorCode: string(claude.ErrInternal),
+		})
+		return
+	}
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (s *Server) HandleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.jobs.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "Job not found."})
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// HandleCancelJob cancels a queued or running job. The job is returned as
+// it was when cancellation was requested.
+func (s *Server) HandleCancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.jobs.Cancel(r.Context(), mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, jobs.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "Job not found."})
+	case errors.Is(err, jobs.ErrFinished):
+		writeJSON(w, http.StatusConflict, models.ErrorResponse{Error: "The job has already finished."})
+	default:
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"claude-web-go/internal/auth"
+	"claude-web-go/internal/logger"
+	"claude-web-go/internal/metrics"
+	"claude-web-go/internal/tracing"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SecurityHeaders adds headers that apply to every response, including the
+// static frontend.
+func SecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestIDHeader carries the ID correlating a request's log lines. A
+// caller or proxy may set it; otherwise one is generated.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds IDs taken from callers, which end up in every
+// log line of the request.
+const maxRequestIDLength = 128
+
+// RequestID gives every request an ID, taken from X-Request-ID when the
+// caller sent a usable one, echoes it in the response and attaches a
+// logger carrying it to the request context.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		log := logger.Log.WithField("requestID", id)
+		next.ServeHTTP(w, r.WithContext(logger.WithContext(r.Context(), log)))
+	})
+}
+
+// validRequestID accepts short IDs of printable ASCII, so callers can't
+// forge log lines or flood the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Identify attaches the caller's identity, taken from headers set by the
+// authenticating reverse proxy, to the request context. It does nothing
+// unless AUTH_USER_HEADER is set, since the headers can only be trusted when
+// the proxy strips them from incoming requests.
+func Identify(next http.Handler) http.Handler {
+	userHeader := os.Getenv("AUTH_USER_HEADER")
+	groupsHeader := os.Getenv("AUTH_GROUPS_HEADER")
+	if userHeader == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := r.Header.Get(userHeader)
+		if user == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		identity := &auth.Identity{User: user}
+		if groupsHeader != "" {
+			for _, group := range strings.Split(r.Header.Get(groupsHeader), ",") {
+				if group = strings.TrimSpace(group); group != "" {
+					identity.Groups = append(identity.Groups, group)
+				}
+			}
+		}
+
+		ctx := auth.WithIdentity(r.Context(), identity)
+		ctx = logger.WithContext(ctx, logger.FromContext(ctx).WithField("user", user))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Instrument counts requests and their duration by route template, so
+// IDs in paths don't create a series each, and serves each request in a
+// span continuing the caller's trace, if any. It must run as mux
+// middleware, after a route has matched.
+func Instrument(next http.Handler) http.Handler {
+	tracer := tracing.Tracer("api")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+		if traceID := tracing.TraceID(ctx); traceID != "" {
+			ctx = logger.WithContext(ctx, logger.FromContext(ctx).WithField("traceID", traceID))
+		}
+
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(recorder.status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(route, r.Method).Observe(time.Since(started).Seconds())
+	})
+}
+
+// statusRecorder remembers the status code written through it. It passes
+// hijacking and flushing through for WebSockets and streamed archives.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	// A hijacked connection is reported as switching protocols.
+	r.status = http.StatusSwitchingProtocols
+	r.wroteHeader = true
+	return hijacker.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"claude-web-go/internal/claude"
+	"claude-web-go/internal/models"
+	"claude-web-go/internal/scheduler"
+	"github.com/gorilla/mux"
+)
+
+// HandleCreateSchedule stores a schedule. Its runs deliver their results to
+// the schedule's session, and to its webhook if it has one.
+func (s *Server) HandleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var schedule models.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{
+			Error:     "The request body is not valid JSON.",
+			ErrorCode: string(claude.ErrInvalidRequest),
+		})
+		return
+	}
+
+	created, err := s.scheduler.Create(r.Context(), schedule)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/schedules/"+created.ID)
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) HandleListSchedules(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.scheduler.List(r.Context()))
+}
+
+// HandleGetSchedule returns a schedule with its run history.
+func (s *Server) HandleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := s.scheduler.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, schedule)
+}
+
+// HandleUpdateSchedule replaces a schedule's definition. Pausing and
+// resuming is done by updating its paused field.
+func (s *Server) HandleUpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	var schedule models.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&schedule); err != nil {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{
+			Error:     "The request body is not valid JSON.",
+			ErrorCode: string(claude.ErrInvalidRequest),
+		})
+		return
+	}
+
+	updated, err := s.scheduler.Update(r.Context(), mux.Vars(r)["id"], schedule)
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (s *Server) HandleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	if err := s.scheduler.Delete(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRunSchedule starts a run at once and returns the schedule with the
+// run in its history.
+func (s *Server) HandleRunSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := s.scheduler.RunNow(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, schedule)
+}
+
+// HandleListSessionJobs returns the caller's jobs in a session, oldest
+// first, so the client can show results of runs it didn't start.
+func (s *Server) HandleListSessionJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.jobs.List(r.Context(), mux.Vars(r)["sessionId"]))
+}
+
+func writeScheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, scheduler.ErrAnonymous):
+		writeJSON(w, http.StatusUnauthorized, models.ErrorResponse{Error: "Sign in to create schedules."})
+	case errors.Is(err, scheduler.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "Schedule not found."})
+	case errors.Is(err, scheduler.ErrInvalid):
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{
+			Error:     err.Error(),
+			ErrorCode: string(claude.ErrInvalidRequest),
+		})
+	default:
+		writeJSON(w, http.StatusInternalServerError, models.ErrorResponse{
+			Error:     "The schedule could not be saved.",
+			ErrorCode: string(claude.ErrInternal),
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"errors"
+
+	"claude-web-go/internal/logger"
+	"github.com/gorilla/websocket"
+)
+
+// openSocket registers a WebSocket connection, which http.Server.Shutdown
+// doesn't track once it has been hijacked. It returns false once the
+// server is draining.
+func (s *Server) openSocket(conn *websocket.Conn) bool {
+	s.socketsMu.Lock()
+	defer s.socketsMu.Unlock()
+
+	if s.draining {
+		return false
+	}
+	s.sockets[conn] = false
+	s.socketsOpen.Add(1)
+	return true
+}
+
+func (s *Server) closeSocket(conn *websocket.Conn) {
+	s.socketsMu.Lock()
+	defer s.socketsMu.Unlock()
+
+	delete(s.sockets, conn)
+	s.socketsOpen.Done()
+}
+
+// socketBusy records whether a connection is running a message. When it
+// goes idle during a drain it reports false, and the connection should be
+// closed.
+func (s *Server) socketBusy(conn *websocket.Conn, busy bool) bool {
+	s.socketsMu.Lock()
+	defer s.socketsMu.Unlock()
+
+	s.sockets[conn] = busy
+	return busy || !s.draining
+}
+
+// DrainWebSockets closes idle WebSocket connections and has busy ones
+// close after answering their current message. It is registered with
+// http.Server.RegisterOnShutdown.
+func (s *Server) DrainWebSockets() {
+	s.socketsMu.Lock()
+	defer s.socketsMu.Unlock()
+
+	s.draining = true
+	for conn, busy := range s.sockets {
+		if !busy {
+			conn.Close()
+		}
+	}
+}
+
+// Shutdown stops the background work once the HTTP server has stopped
+// taking requests: no more schedule runs are started, and WebSocket
+// messages, running jobs and webhook deliveries under way get until ctx is
+// done to finish. Work still going then is cancelled, and Shutdown waits
+// for it to stop.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.scheduler.Stop()
+
+	sockets := make(chan struct{})
+	go func() {
+		s.socketsOpen.Wait()
+		close(sockets)
+	}()
+	select {
+	case <-sockets:
+	case <-ctx.Done():
+		// Messages still running were started in the requests' context,
+		// which the caller cancels along with ctx.
+		logger.Log.Warn("WebSocket messages still running at shutdown")
+	}
+
+	return errors.Join(
+		s.jobs.Shutdown(ctx),
+		s.webhooks.Shutdown(ctx),
+	)
+}
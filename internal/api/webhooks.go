@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"claude-web-go/internal/auth"
+	"claude-web-go/internal/claude"
+	"claude-web-go/internal/models"
+	"claude-web-go/internal/webhooks"
+	"github.com/gorilla/mux"
+)
+
+// HandleCreateWebhook subscribes the caller to events. The response is the
+// only one that includes the webhook's secret.
+func (s *Server) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var hook models.Webhook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{
+			Error:     "The request body is not valid JSON.",
+			ErrorCode: string(claude.ErrInvalidRequest),
+		})
+		return
+	}
+
+	created, err := s.webhooks.Create(r.Context(), hook)
+	if errors.Is(err, webhooks.ErrAnonymous) {
+		writeJSON(w, http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Sign in to subscribe to webhooks.",
+		})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{
+			Error:     err.Error(),
+			ErrorCode: string(claude.ErrInvalidRequest),
+		})
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) HandleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.webhooks.List(r.Context()))
+}
+
+func (s *Server) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	err := s.webhooks.Delete(r.Context(), mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, webhooks.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "Webhook not found."})
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: "The webhook could not be deleted."})
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleWebhookDeliveries returns the delivery log of a webhook, including
+// a job's own webhook, newest first.
+func (s *Server) HandleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := s.webhooks.Deliveries(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "Webhook not found."})
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// HandleTestWebhook sends a sample event and returns how its delivery went.
+func (s *Server) HandleTestWebhook(w http.ResponseWriter, r *http.Request) {
+	delivery, err := s.webhooks.Test(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "Webhook not found."})
+		return
+	}
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+// notifyJob is the jobs.Notifier: it records the outcome of schedule runs,
+// then publishes the files a job created and its outcome.
+func (s *Server) notifyJob(owner string, job models.Job, webhook *models.Webhook) {
+	s.scheduler.JobFinished(job)
+
+	if job.Response != nil {
+		for _, file := range job.Response.Files {
+			s.webhooks.Publish(owner, webhook, models.EventFileCreated, models.FileCreatedEvent{
+				SessionID: job.SessionID,
+				JobID:     job.ID,
+				File:      file,
+			})
+		}
+	}
+
+	event := models.EventJobFailed
+	switch job.Status {
+	case models.JobCompleted:
+		event = models.EventJobCompleted
+	case models.JobCancelled:
+		event = models.EventJobCancelled
+	}
+	s.webhooks.Publish(owner, webhook, event, job)
+}
+
+// notifyMessage publishes the files a chat message created and then the
+// message itself.
+func (s *Server) notifyMessage(ctx context.Context, response models.ChatResponse) {
+	owner := ""
+	if identity := auth.IdentityFromContext(ctx); identity != nil {
+		owner = identity.User
+	}
+
+	for _, file := range response.Files {
+		s.webhooks.Publish(owner, nil, models.EventFileCreated, models.FileCreatedEvent{
+			SessionID: response.SessionID,
+			File:      file,
+		})
+	}
+
+	event := models.EventMessageCompleted
+	if response.ErrorCode != "" {
+		event = models.EventMessageFailed
+	}
+	s.webhooks.Publish(owner, nil, event, response)
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AnthropicProvider runs claude against the Anthropic API. The key is read
+// from ANTHROPIC_API_KEY_FILE on every run, so a rotated secret is picked
+// up without a restart; ANTHROPIC_API_KEY is the fallback for local use.
+type AnthropicProvider struct {
+	keyFile string
+	key     string
+
+	mu          sync.RWMutex
+	lastRefresh time.Time
+	lastError   error
+}
+
+func NewAnthropicProvider() (*AnthropicProvider, error) {
+	p := &AnthropicProvider{
+		keyFile: os.Getenv("ANTHROPIC_API_KEY_FILE"),
+		key:     os.Getenv("ANTHROPIC_API_KEY"),
+	}
+	if p.keyFile == "" && p.key == "" {
+		return nil, fmt.Errorf("the anthropic provider needs ANTHROPIC_API_KEY_FILE or ANTHROPIC_API_KEY")
+	}
+
+	if _, err := p.apiKey(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *AnthropicProvider) Name() string {
+	return ProviderAnthropic
+}
+
+func (p *AnthropicProvider) Environment(ctx context.Context, base []string, id *Identity) ([]string, error) {
+	key, err := p.apiKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return ReplaceEnv(base, map[string]string{
+		"ANTHROPIC_API_KEY": key,
+	}, providerVariables...), nil
+}
+
+func (p *AnthropicProvider) DefaultModels() (string, string) {
+	return "claude-sonnet-4-20250514", "claude-3-5-haiku-20241022"
+}
+
+func (p *AnthropicProvider) Status() CredentialStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return CredentialStatus{
+		Valid:       p.lastError == nil,
+		LastRefresh: p.lastRefresh,
+		LastError:   p.lastError,
+	}
+}
+
+// apiKey returns the current key, recording the outcome for Status.
+func (p *AnthropicProvider) apiKey() (string, error) {
+	key := p.key
+	var err error
+	if p.keyFile != "" {
+		var data []byte
+		data, err = os.ReadFile(p.keyFile)
+		key = strings.TrimSpace(string(data))
+		if err == nil && key == "" {
+			err = fmt.Errorf("API key file %s is empty", p.keyFile)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to read Anthropic API key: %w", err)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastError = err
+	if err != nil {
+		return "", err
+	}
+	p.lastRefresh = time.Now()
+	return key, nil
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+)
+
+// BedrockProvider runs claude against Amazon Bedrock with per-caller AWS
+// credentials.
+type BedrockProvider struct {
+	credentials *CredentialBroker
+}
+
+func NewBedrockProvider(ctx context.Context) (*BedrockProvider, error) {
+	credentials, err := NewCredentialBroker(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep expiring credentials fresh so requests never run with expired
+	// credentials or wait on STS.
+	StartRefresher(ctx, credentials.Default())
+
+	return &BedrockProvider{credentials: credentials}, nil
+}
+
+func (p *BedrockProvider) Name() string {
+	return ProviderBedrock
+}
+
+// Environment fetches credentials per run and hands them only to the child
+// process, so a long-running server never uses an expired session token,
+// and each caller's usage is billed to their own role.
+func (p *BedrockProvider) Environment(ctx context.Context, base []string, id *Identity) ([]string, error) {
+	config, err := GetAWSConfig(ctx, p.credentials.ForIdentity(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get AWS credentials: %w", err)
+	}
+
+	set := map[string]string{
+		"CLAUDE_CODE_USE_BEDROCK": "1",
+		"AWS_ACCESS_KEY_ID":       config.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY":   config.SecretAccessKey,
+		"AWS_REGION":              config.Region,
+	}
+	if config.SessionToken != "" {
+		set["AWS_SESSION_TOKEN"] = config.SessionToken
+	}
+	return ReplaceEnv(base, set, providerVariables...), nil
+}
+
+func (p *BedrockProvider) DefaultModels() (string, string) {
+	return "us.anthropic.claude-sonnet-4-20250514-v1:0", "anthropic.claude-3-5-haiku-20241022-v1:0"
+}
+
+func (p *BedrockProvider) Status() CredentialStatus {
+	return p.credentials.Default().Status()
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"claude-web-go/internal/logger"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// CredentialBroker hands out credentials per caller. Callers matched by the
+// role map get their own assumed role or session tags, each with its own
+// cache; everyone else shares the default provider.
+type CredentialBroker struct {
+	cfg         aws.Config
+	base        CredentialProvider
+	defaultRole *RoleConfig
+	roles       *RoleMap
+
+	// ctx scopes the background refreshers of per-role providers.
+	ctx       context.Context
+	mu        sync.Mutex
+	providers map[string]CredentialProvider
+}
+
+// NewCredentialBroker sets up the default provider and loads the role map
+// from BEDROCK_ROLE_MAP_FILE. Refreshers it starts stop when ctx is done.
+func NewCredentialBroker(ctx context.Context) (*CredentialBroker, error) {
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultRole, err := RoleConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := LoadRoleMap()
+	if err != nil {
+		return nil, err
+	}
+	if roles != nil {
+		if err := roles.validate(defaultRole); err != nil {
+			return nil, err
+		}
+		logger.Log.WithFields(map[string]interface{}{
+			"users":  len(roles.Users),
+			"groups": len(roles.Groups),
+		}).Info("Loaded per-caller role map")
+	}
+
+	return &CredentialBroker{
+		cfg:         cfg,
+		base:        newProvider(cfg, defaultRole),
+		defaultRole: defaultRole,
+		roles:       roles,
+		ctx:         ctx,
+		providers:   make(map[string]CredentialProvider),
+	}, nil
+}
+
+// Default returns the provider used for callers without a role assignment.
+func (b *CredentialBroker) Default() CredentialProvider {
+	return b.base
+}
+
+// ForIdentity returns the provider for a caller; id may be nil.
+func (b *CredentialBroker) ForIdentity(id *Identity) CredentialProvider {
+	assignment, ok := b.roles.Lookup(id)
+	if !ok {
+		return b.base
+	}
+
+	role := b.roleFor(assignment)
+	key := roleKey(role)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if provider, ok := b.providers[key]; ok {
+		return provider
+	}
+
+	logger.Log.WithFields(map[string]interface{}{
+		"user":    id.User,
+		"roleArn": role.ARN,
+		"tags":    role.Tags,
+	}).Info("Creating credential cache for role")
+
+	provider := NewSessionManager(b.cfg, role)
+	b.providers[key] = provider
+	StartRefresher(b.ctx, provider)
+	return provider
+}
+
+// roleFor applies an assignment on top of the default role settings.
+func (b *CredentialBroker) roleFor(assignment RoleAssignment) *RoleConfig {
+	role := RoleConfig{
+		SessionName: defaultRoleSessionName,
+		Duration:    defaultRoleDuration,
+	}
+	if b.defaultRole != nil {
+		role = *b.defaultRole
+	}
+
+	if assignment.RoleARN != "" && assignment.RoleARN != role.ARN {
+		// The default role's external ID and MFA device belong to it alone.
+		role.ARN = assignment.RoleARN
+		role.ExternalID = ""
+		role.MFASerial = ""
+		role.MFAToken = nil
+	}
+	if assignment.ExternalID != "" {
+		role.ExternalID = assignment.ExternalID
+	}
+	role.Tags = assignment.Tags
+	return &role
+}
+
+// roleKey identifies the credentials a role config produces.
+func roleKey(role *RoleConfig) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s|%s", role.ARN, role.ExternalID)
+	for _, key := range sortedKeys(role.Tags) {
+		fmt.Fprintf(&b, "|%s=%s", key, role.Tags[key])
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"claude-web-go/internal/logger"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// ChainProvider serves credentials from the SDK's default provider chain:
+// environment variables, shared config and SSO profiles, web identity
+// tokens (EKS IRSA), ECS container credentials and EC2 instance profiles.
+type ChainProvider struct {
+	credentialCache
+	provider aws.CredentialsProvider
+}
+
+func NewChainProvider(cfg aws.Config) *ChainProvider {
+	return &ChainProvider{provider: cfg.Credentials}
+}
+
+func (p *ChainProvider) Retrieve(ctx context.Context) (*Credentials, error) {
+	return p.retrieve(ctx, p.fetch)
+}
+
+func (p *ChainProvider) Refresh(ctx context.Context) (*Credentials, error) {
+	return p.refresh(ctx, func(ctx context.Context) (*Credentials, error) {
+		// The SDK caches too; make it go back to the source.
+		if cache, ok := p.provider.(*aws.CredentialsCache); ok {
+			cache.Invalidate()
+		}
+		return p.fetch(ctx)
+	})
+}
+
+func (p *ChainProvider) fetch(ctx context.Context) (*Credentials, error) {
+	if p.provider == nil {
+		return nil, fmt.Errorf("no AWS credentials found in the default provider chain")
+	}
+
+	creds, err := p.provider.Retrieve(ctx)
+	if err != nil {
+		logger.Log.WithError(err).Error("Failed to retrieve credentials from the default chain")
+		return nil, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+
+	result := fromAWS(creds)
+	fields := map[string]interface{}{
+		"source": result.Source,
+	}
+	if !result.Expiration.IsZero() {
+		fields["expiration"] = result.Expiration.Format(time.RFC3339)
+	}
+	logger.Log.WithFields(fields).Info("Retrieved credentials from the default chain")
+
+	return result, nil
+}
@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// fakeProvider is an SDK credentials provider that returns results in
+// order and counts the calls.
+type fakeProvider struct {
+	results []fakeResult
+	calls   int
+}
+
+type fakeResult struct {
+	creds aws.Credentials
+	err   error
+}
+
+func (f *fakeProvider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	result := f.results[min(f.calls, len(f.results)-1)]
+	f.calls++
+	return result.creds, result.err
+}
+
+func fakeCredentials(id string, expires time.Duration) fakeResult {
+	creds := aws.Credentials{
+		AccessKeyID:     id,
+		SecretAccessKey: "secret-" + id,
+		Source:          "fake",
+	}
+	if expires != 0 {
+		creds.CanExpire = true
+		creds.Expires = time.Now().Add(expires)
+	}
+	return fakeResult{creds: creds}
+}
+
+// isolateAWSEnv clears every setting the SDK's default chain reads, so
+// tests only see the sources they set up.
+func isolateAWSEnv(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, key := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+		"AWS_PROFILE", "AWS_DEFAULT_PROFILE", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+		"BEDROCK_ROLE_ARN", "STS_ENDPOINT_URL",
+	} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_REGION", "us-east-1")
+	return dir
+}
+
+func TestNewProviderSelection(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		role *RoleConfig
+		want string
+	}{
+		{
+			name: "role is assumed",
+			env:  map[string]string{"AWS_ACCESS_KEY_ID": "AKIA", "AWS_SECRET_ACCESS_KEY": "secret"},
+			role: &RoleConfig{ARN: "arn:aws:iam::123456789012:role/bedrock"},
+			want: "assume role",
+		},
+		{
+			name: "static keys get a session token",
+			env:  map[string]string{"AWS_ACCESS_KEY_ID": "AKIA", "AWS_SECRET_ACCESS_KEY": "secret"},
+			want: "session token",
+		},
+		{
+			name: "temporary keys go through the chain",
+			env:  map[string]string{"AWS_ACCESS_KEY_ID": "ASIA", "AWS_SECRET_ACCESS_KEY": "secret", "AWS_SESSION_TOKEN": "token"},
+			want: "chain",
+		},
+		{
+			name: "no keys go through the chain",
+			want: "chain",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateAWSEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			var got string
+			switch p := newProvider(aws.Config{Region: "us-east-1"}, tt.role).(type) {
+			case *SessionManager:
+				got = "session token"
+				if p.role != nil {
+					got = "assume role"
+				}
+			case *ChainProvider:
+				got = "chain"
+			default:
+				t.Fatalf("unexpected provider %T", p)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainProviderCaching(t *testing.T) {
+	failure := fakeResult{err: errors.New("no credentials")}
+
+	tests := []struct {
+		name      string
+		results   []fakeResult
+		retrieves int
+		wantCalls int
+		wantErrs  int
+		wantKey   string
+	}{
+		{
+			name:      "expiring credentials are cached",
+			results:   []fakeResult{fakeCredentials("first", time.Hour), fakeCredentials("second", time.Hour)},
+			retrieves: 3,
+			wantCalls: 1,
+			wantKey:   "first",
+		},
+		{
+			name:      "credentials without expiry are cached",
+			results:   []fakeResult{fakeCredentials("first", 0), fakeCredentials("second", 0)},
+			retrieves: 3,
+			wantCalls: 1,
+			wantKey:   "first",
+		},
+		{
+			name:      "credentials about to expire are fetched again",
+			results:   []fakeResult{fakeCredentials("first", 2*time.Minute), fakeCredentials("second", time.Hour)},
+			retrieves: 3,
+			wantCalls: 2,
+			wantKey:   "second",
+		},
+		{
+			name:      "errors are not cached",
+			results:   []fakeResult{failure, failure, fakeCredentials("recovered", time.Hour)},
+			retrieves: 4,
+			wantCalls: 3,
+			wantErrs:  2,
+			wantKey:   "recovered",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeProvider{results: tt.results}
+			provider := NewChainProvider(aws.Config{Credentials: fake})
+
+			errs := 0
+			var last *Credentials
+			for i := 0; i < tt.retrieves; i++ {
+				creds, err := provider.Retrieve(context.Background())
+				if err != nil {
+					errs++
+					if status := provider.Status(); status.LastError == nil {
+						t.Errorf("retrieve %d: status has no error after a failure", i+1)
+					}
+					continue
+				}
+				last = creds
+			}
+
+			if fake.calls != tt.wantCalls {
+				t.Errorf("got %d calls to the source, want %d", fake.calls, tt.wantCalls)
+			}
+			if errs != tt.wantErrs {
+				t.Errorf("got %d errors, want %d", errs, tt.wantErrs)
+			}
+			if last == nil || last.AccessKeyID != tt.wantKey {
+				t.Fatalf("got credentials %+v, want key %s", last, tt.wantKey)
+			}
+			if status := provider.Status(); !status.Valid || status.LastError != nil {
+				t.Errorf("got status %+v, want valid without error", status)
+			}
+		})
+	}
+}
+
+func TestChainProviderRefreshBypassesSDKCache(t *testing.T) {
+	fake := &fakeProvider{results: []fakeResult{fakeCredentials("first", time.Hour), fakeCredentials("second", time.Hour)}}
+	provider := NewChainProvider(aws.Config{Credentials: aws.NewCredentialsCache(fake)})
+
+	if _, err := provider.Retrieve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	creds, err := provider.Refresh(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "second" || fake.calls != 2 {
+		t.Errorf("got key %s after %d calls, want second after 2", creds.AccessKeyID, fake.calls)
+	}
+}
+
+func TestDefaultChainOrder(t *testing.T) {
+	const profile = "[default]\naws_access_key_id = AKIDPROFILE\naws_secret_access_key = profile-secret\n"
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		profile    bool
+		wantKey    string
+		wantSource string
+		wantErr    bool
+	}{
+		{
+			name:       "environment comes before the shared profile",
+			env:        map[string]string{"AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "env-secret", "AWS_SESSION_TOKEN": "token"},
+			profile:    true,
+			wantKey:    "AKIDENV",
+			wantSource: "EnvConfigCredentials",
+		},
+		{
+			name:       "missing environment keys fall through to the shared profile",
+			profile:    true,
+			wantKey:    "AKIDPROFILE",
+			wantSource: "SharedConfigCredentials",
+		},
+		{
+			name:    "no source fails",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := isolateAWSEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			if tt.profile {
+				if err := os.WriteFile(filepath.Join(dir, "credentials"), []byte(profile), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			cfg, err := loadConfig(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			creds, err := NewChainProvider(cfg).Retrieve(ctx)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got credentials from %s, want an error", creds.Source)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.AccessKeyID != tt.wantKey || !strings.HasPrefix(creds.Source, tt.wantSource) {
+				t.Errorf("got key %s from %s, want %s from %s", creds.AccessKeyID, creds.Source, tt.wantKey, tt.wantSource)
+			}
+		})
+	}
+}
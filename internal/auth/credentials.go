@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"claude-web-go/internal/logger"
+	"claude-web-go/internal/metrics"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+const (
+	// Cached credentials closer than this to expiry are never handed out.
+	minCredentialLifetime = 5 * time.Minute
+	// The background refresher renews credentials this long before expiry,
+	// or a quarter of their lifetime before for shorter-lived ones, so
+	// requests never have to wait on STS.
+	refreshAhead = 30 * time.Minute
+	refreshRetry = time.Minute
+)
+
+// Credentials are the AWS credentials handed to a claude process. A zero
+// Expiration means they do not expire.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+	// Source names where the credentials came from, for logging.
+	Source string
+}
+
+func (c *Credentials) expiresWithin(d time.Duration) bool {
+	return !c.Expiration.IsZero() && time.Until(c.Expiration) <= d
+}
+
+// CredentialStatus is a point-in-time view of a provider's cached
+// credentials, for health checks.
+type CredentialStatus struct {
+	Valid       bool
+	Expiration  time.Time
+	LastRefresh time.Time
+	LastError   error
+}
+
+// CredentialProvider supplies credentials for claude runs.
+type CredentialProvider interface {
+	// Retrieve returns cached credentials, refreshing them first if they
+	// are expired or about to expire.
+	Retrieve(ctx context.Context) (*Credentials, error)
+	// Refresh fetches new credentials regardless of the cached ones.
+	Refresh(ctx context.Context) (*Credentials, error)
+	// Status reports on the cached credentials without refreshing.
+	Status() CredentialStatus
+}
+
+// NewCredentialProvider picks the provider for this deployment. When
+// BEDROCK_ROLE_ARN is set, that role is assumed. Otherwise long-lived
+// access keys in AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY are exchanged for
+// session tokens as before; everything else (web identity on EKS, ECS task
+// roles, EC2 instance profiles, SSO and shared config profiles, temporary
+// keys in the environment) goes through the SDK's default chain.
+func NewCredentialProvider(ctx context.Context) (CredentialProvider, error) {
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := RoleConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return newProvider(cfg, role), nil
+}
+
+func loadConfig(ctx context.Context) (aws.Config, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(Region()))
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	return cfg, nil
+}
+
+func newProvider(cfg aws.Config, role *RoleConfig) CredentialProvider {
+	if role != nil {
+		// The role is assumed with whatever base credentials the default
+		// chain finds.
+		logger.Log.WithField("roleArn", role.ARN).Info("Using STS AssumeRole")
+		return NewSessionManager(cfg, role)
+	}
+
+	if hasStaticLongTermKeys() {
+		logger.Log.Info("Using static access keys with STS session tokens")
+		return NewSessionManager(cfg, nil)
+	}
+
+	logger.Log.Info("Using the AWS default credential chain")
+	return NewChainProvider(cfg)
+}
+
+// stsEndpoint returns the STS endpoint override, if any.
+func stsEndpoint() string {
+	return os.Getenv("STS_ENDPOINT_URL")
+}
+
+func hasStaticLongTermKeys() bool {
+	return os.Getenv("AWS_ACCESS_KEY_ID") != "" &&
+		os.Getenv("AWS_SECRET_ACCESS_KEY") != "" &&
+		os.Getenv("AWS_SESSION_TOKEN") == ""
+}
+
+// Region returns the AWS region for Bedrock and STS calls.
+func Region() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	if region := os.Getenv("AWS_DEFAULT_REGION"); region != "" {
+		return region
+	}
+	return "us-east-1"
+}
+
+// StartRefresher renews a provider's credentials in the background shortly
+// before they expire, retrying failures every minute, until ctx is
+// cancelled. Credentials without an expiry are never refreshed.
+func StartRefresher(ctx context.Context, provider CredentialProvider) {
+	go func() {
+		for {
+			status := provider.Status()
+			if status.LastError == nil && status.Valid && status.Expiration.IsZero() {
+				return
+			}
+
+			timer := time.NewTimer(refreshDelay(status))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if _, err := provider.Refresh(ctx); err != nil {
+				logger.Log.WithError(err).Warn("Background credential refresh failed")
+			}
+		}
+	}()
+}
+
+// refreshDelay returns how long the refresher waits before renewing the
+// credentials described by status.
+func refreshDelay(status CredentialStatus) time.Duration {
+	if status.LastError != nil || status.Expiration.IsZero() {
+		return refreshRetry
+	}
+	ahead := min(refreshAhead, status.Expiration.Sub(status.LastRefresh)/4)
+	return max(time.Until(status.Expiration)-ahead, refreshRetry)
+}
+
+// credentialCache holds the state shared by every provider: the current
+// credentials and the outcome of the last refresh.
+type credentialCache struct {
+	current     *Credentials
+	lastRefresh time.Time
+	lastError   error
+	mu          sync.RWMutex
+	// fetchMu lets only one caller fetch at a time, while others keep
+	// being served the cached credentials.
+	fetchMu sync.Mutex
+}
+
+// retrieve returns the cached credentials, or calls fetch when they are
+// missing or about to expire.
+func (c *credentialCache) retrieve(ctx context.Context, fetch func(context.Context) (*Credentials, error)) (*Credentials, error) {
+	if creds, ok := c.cached(); ok {
+		return creds, nil
+	}
+
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	// Another caller may have refreshed while we waited.
+	if creds, ok := c.cached(); ok {
+		return creds, nil
+	}
+	return c.store(fetch(ctx))
+}
+
+// refresh calls fetch regardless of the cached credentials.
+func (c *credentialCache) refresh(ctx context.Context, fetch func(context.Context) (*Credentials, error)) (*Credentials, error) {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+
+	return c.store(fetch(ctx))
+}
+
+// cached returns the current credentials if they are not about to expire.
+func (c *credentialCache) cached() (*Credentials, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.current == nil || c.current.expiresWithin(minCredentialLifetime) {
+		return nil, false
+	}
+	return c.current, true
+}
+
+// store records the outcome of a fetch.
+func (c *credentialCache) store(creds *Credentials, err error) (*Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		metrics.CredentialRefreshes.WithLabelValues("error").Inc()
+		c.lastError = err
+		return nil, err
+	}
+
+	metrics.CredentialRefreshes.WithLabelValues("ok").Inc()
+	c.current = creds
+	c.lastRefresh = time.Now()
+	c.lastError = nil
+	return creds, nil
+}
+
+func (c *credentialCache) Status() CredentialStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status := CredentialStatus{
+		LastRefresh: c.lastRefresh,
+		LastError:   c.lastError,
+	}
+	if c.current != nil {
+		status.Expiration = c.current.Expiration
+		status.Valid = c.current.Expiration.IsZero() || time.Until(c.current.Expiration) > 0
+	}
+	return status
+}
+
+// fromAWS converts SDK credentials.
+func fromAWS(creds aws.Credentials) *Credentials {
+	result := &Credentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Source:          creds.Source,
+	}
+	if creds.CanExpire {
+		result.Expiration = creds.Expires
+	}
+	return result
+}
@@ -0,0 +1,33 @@
+package auth
+
+import "context"
+
+// Identity is the authenticated caller of a request, as asserted by the
+// reverse proxy in front of the server.
+type Identity struct {
+	User   string
+	Groups []string
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// IdentityFromContext returns the caller's identity, or nil for anonymous
+// requests.
+func IdentityFromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// UserFromContext returns the caller's user name, or "" for anonymous
+// requests.
+func UserFromContext(ctx context.Context) string {
+	if id := IdentityFromContext(ctx); id != nil {
+		return id.User
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"claude-web-go/internal/metrics"
+)
+
+// Provider names accepted by LLM_PROVIDER and profiles.
+const (
+	ProviderBedrock   = "bedrock"
+	ProviderAnthropic = "anthropic"
+	ProviderVertex    = "vertex"
+)
+
+// LLMProvider is a backend the claude CLI can talk to. It produces the
+// environment for each claude process.
+type LLMProvider interface {
+	Name() string
+	// Environment returns base with the provider's settings and credentials
+	// for the caller applied. id may be nil.
+	Environment(ctx context.Context, base []string, id *Identity) ([]string, error)
+	// DefaultModels returns the main and small/fast model IDs used when
+	// none are configured.
+	DefaultModels() (model, smallFastModel string)
+	// Status reports on the provider's credentials without refreshing them.
+	Status() CredentialStatus
+}
+
+// providerVariables are the settings a provider may set; every provider
+// starts from an environment without them so nothing leaks between
+// providers.
+var providerVariables = []string{
+	"CLAUDE_CODE_USE_BEDROCK",
+	"CLAUDE_CODE_USE_VERTEX",
+	"ANTHROPIC_API_KEY",
+	"ANTHROPIC_API_KEY_FILE",
+	"ANTHROPIC_VERTEX_PROJECT_ID",
+	"CLOUD_ML_REGION",
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_REGION",
+}
+
+// DefaultProviderName returns the provider selected by LLM_PROVIDER.
+func DefaultProviderName() string {
+	if name := os.Getenv("LLM_PROVIDER"); name != "" {
+		return strings.ToLower(name)
+	}
+	return ProviderBedrock
+}
+
+// NewLLMProvider sets up the named provider from the environment. The time
+// to expiry of its credentials is published as a metric.
+func NewLLMProvider(ctx context.Context, name string) (LLMProvider, error) {
+	var provider LLMProvider
+	var err error
+	switch name {
+	case ProviderBedrock:
+		provider, err = NewBedrockProvider(ctx)
+	case ProviderAnthropic:
+		provider, err = NewAnthropicProvider()
+	case ProviderVertex:
+		provider, err = NewVertexProvider()
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.WatchCredentials(name, func() time.Time {
+		return provider.Status().Expiration
+	})
+	return provider, nil
+}
+
+// ReplaceEnv returns base without the unset keys and with set applied.
+func ReplaceEnv(base []string, set map[string]string, unset ...string) []string {
+	drop := make(map[string]bool, len(set)+len(unset))
+	for _, key := range unset {
+		drop[key] = true
+	}
+	for key := range set {
+		drop[key] = true
+	}
+
+	env := make([]string, 0, len(base)+len(set))
+	for _, kv := range base {
+		key, _, _ := strings.Cut(kv, "=")
+		if !drop[key] {
+			env = append(env, kv)
+		}
+	}
+	for _, key := range sortedKeys(set) {
+		env = append(env, key+"="+set[key])
+	}
+	return env
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRoleSessionName = "claude-web"
+	defaultRoleDuration    = time.Hour
+	mfaTokenTimeout        = 30 * time.Second
+)
+
+// RoleConfig describes the role assumed for Bedrock access.
+type RoleConfig struct {
+	ARN         string
+	ExternalID  string
+	SessionName string
+	Duration    time.Duration
+	// MFASerial is the serial number or ARN of the MFA device the role's
+	// trust policy requires, if any.
+	MFASerial string
+	// MFAToken returns a current code for MFASerial. It is called on every
+	// refresh, since codes can't be reused.
+	MFAToken func(ctx context.Context) (string, error)
+	// Tags are passed to AssumeRole as session tags, for cost allocation
+	// and attribute-based access control.
+	Tags map[string]string
+}
+
+// RoleConfigFromEnv reads the role settings from the environment. It
+// returns nil when BEDROCK_ROLE_ARN is not set.
+func RoleConfigFromEnv() (*RoleConfig, error) {
+	arn := os.Getenv("BEDROCK_ROLE_ARN")
+	if arn == "" {
+		return nil, nil
+	}
+
+	role := &RoleConfig{
+		ARN:         arn,
+		ExternalID:  os.Getenv("BEDROCK_ROLE_EXTERNAL_ID"),
+		SessionName: os.Getenv("BEDROCK_ROLE_SESSION_NAME"),
+		Duration:    defaultRoleDuration,
+		MFASerial:   os.Getenv("BEDROCK_ROLE_MFA_SERIAL"),
+	}
+	if role.SessionName == "" {
+		role.SessionName = defaultRoleSessionName
+	}
+
+	if value := os.Getenv("BEDROCK_ROLE_DURATION"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BEDROCK_ROLE_DURATION %q: %w", value, err)
+		}
+		// STS accepts 15 minutes up to the role's maximum session duration.
+		if duration < 15*time.Minute || duration > 12*time.Hour {
+			return nil, fmt.Errorf("BEDROCK_ROLE_DURATION must be between 15m and 12h, got %s", duration)
+		}
+		role.Duration = duration
+	}
+
+	if role.MFASerial != "" {
+		command := os.Getenv("BEDROCK_ROLE_MFA_TOKEN_COMMAND")
+		if command == "" {
+			return nil, fmt.Errorf("BEDROCK_ROLE_MFA_SERIAL requires BEDROCK_ROLE_MFA_TOKEN_COMMAND")
+		}
+		role.MFAToken = commandTokenSource(command)
+	}
+
+	return role, nil
+}
+
+// commandTokenSource returns an MFA token source that runs command through
+// the shell and uses the first line it prints.
+func commandTokenSource(command string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, mfaTokenTimeout)
+		defer cancel()
+
+		output, err := exec.CommandContext(ctx, "sh", "-c", command).Output()
+		if err != nil {
+			return "", fmt.Errorf("MFA token command failed: %w", err)
+		}
+
+		token, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+		if token == "" {
+			return "", fmt.Errorf("MFA token command printed nothing")
+		}
+		return token, nil
+	}
+}
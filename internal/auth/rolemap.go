@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// RoleAssignment is the role and session tags used for a user or group.
+// An empty RoleARN means the default role from BEDROCK_ROLE_ARN, so teams
+// can share one role and be told apart by tags alone.
+type RoleAssignment struct {
+	RoleARN    string            `json:"roleArn"`
+	ExternalID string            `json:"externalId"`
+	Tags       map[string]string `json:"tags"`
+}
+
+// RoleMap maps callers to role assignments. A user entry wins over group
+// entries, and groups are tried in the order the proxy listed them.
+type RoleMap struct {
+	Users  map[string]RoleAssignment `json:"users"`
+	Groups map[string]RoleAssignment `json:"groups"`
+}
+
+// LoadRoleMap reads the role map from BEDROCK_ROLE_MAP_FILE. It returns nil
+// when the variable is not set.
+func LoadRoleMap() (*RoleMap, error) {
+	path := os.Getenv("BEDROCK_ROLE_MAP_FILE")
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read role map: %w", err)
+	}
+
+	var roles RoleMap
+	if err := json.Unmarshal(data, &roles); err != nil {
+		return nil, fmt.Errorf("failed to parse role map %s: %w", path, err)
+	}
+	return &roles, nil
+}
+
+// Lookup returns the assignment for id, if any.
+func (m *RoleMap) Lookup(id *Identity) (RoleAssignment, bool) {
+	if m == nil || id == nil {
+		return RoleAssignment{}, false
+	}
+	if assignment, ok := m.Users[id.User]; ok && id.User != "" {
+		return assignment, true
+	}
+	for _, group := range id.Groups {
+		if assignment, ok := m.Groups[group]; ok {
+			return assignment, true
+		}
+	}
+	return RoleAssignment{}, false
+}
+
+// validate checks that every assignment resolves to a role.
+func (m *RoleMap) validate(defaultRole *RoleConfig) error {
+	check := func(kind, name string, assignment RoleAssignment) error {
+		if assignment.RoleARN == "" && defaultRole == nil {
+			return fmt.Errorf("role map %s %q has no roleArn and BEDROCK_ROLE_ARN is not set", kind, name)
+		}
+		return nil
+	}
+	for name, assignment := range m.Users {
+		if err := check("user", name, assignment); err != nil {
+			return err
+		}
+	}
+	for name, assignment := range m.Groups {
+		if err := check("group", name, assignment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,107 +3,139 @@ package auth
 import (
 	"context"
 	"fmt"
-	"sync"
 	"time"
 
 	"claude-web-go/internal/logger"
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
 )
 
-type SessionManager struct {
-	baseAccessKey    string
-	baseSecretKey    string
-	region           string
-	currentSession   *SessionCredentials
-	mu               sync.RWMutex
+// stsAPI is the subset of the STS client the session manager uses.
+type stsAPI interface {
+	GetSessionToken(ctx context.Context, params *sts.GetSessionTokenInput, optFns ...func(*sts.Options)) (*sts.GetSessionTokenOutput, error)
+	AssumeRole(ctx context.Context, params *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error)
 }
 
-type SessionCredentials struct {
-	AccessKeyID     string
-	SecretAccessKey string
-	SessionToken    string
-	Expiration      time.Time
+// SessionManager turns base credentials into short-lived STS credentials,
+// so the claude process never sees the base credentials. With a role
+// configured it assumes the role; otherwise it exchanges long-lived access
+// keys for a session token.
+type SessionManager struct {
+	credentialCache
+	client stsAPI
+	role   *RoleConfig
 }
 
-func NewSessionManager(accessKey, secretKey, region string) *SessionManager {
+// NewSessionManager calls STS with the credentials in cfg. role may be nil.
+// STS_ENDPOINT_URL points the client at a different STS endpoint, such as a
+// local stub.
+func NewSessionManager(cfg aws.Config, role *RoleConfig) *SessionManager {
+	client := sts.NewFromConfig(cfg, func(o *sts.Options) {
+		if endpoint := stsEndpoint(); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+	})
+
 	return &SessionManager{
-		baseAccessKey: accessKey,
-		baseSecretKey: secretKey,
-		region:        region,
+		client: client,
+		role:   role,
 	}
 }
 
-func (sm *SessionManager) GetSessionCredentials() (*SessionCredentials, error) {
-	sm.mu.RLock()
-	if sm.currentSession != nil {
-		timeUntilExpiry := time.Until(sm.currentSession.Expiration)
-		logger.Log.WithFields(map[string]interface{}{
-			"expiresIn": timeUntilExpiry.String(),
-			"expiration": sm.currentSession.Expiration.Format(time.RFC3339),
-			"currentTime": time.Now().Format(time.RFC3339),
-		}).Debug("Checking cached session token")
-		
-		if timeUntilExpiry > 5*time.Minute {
-			defer sm.mu.RUnlock()
-			logger.Log.Info("Using cached session token")
-			return sm.currentSession, nil
-		}
-		logger.Log.Info("Session token expired or expiring soon, will refresh")
-	}
-	sm.mu.RUnlock()
+func (sm *SessionManager) Retrieve(ctx context.Context) (*Credentials, error) {
+	return sm.retrieve(ctx, sm.fetch)
+}
 
-	// Need to refresh
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+func (sm *SessionManager) Refresh(ctx context.Context) (*Credentials, error) {
+	return sm.refresh(ctx, sm.fetch)
+}
 
-	// Double-check after acquiring write lock
-	if sm.currentSession != nil && time.Until(sm.currentSession.Expiration) > 5*time.Minute {
-		return sm.currentSession, nil
-	}
+// fetch calls STS for new credentials without touching the cache.
+func (sm *SessionManager) fetch(ctx context.Context) (*Credentials, error) {
+	var creds *Credentials
+	var err error
 
-	logger.Log.WithField("accessKeyPrefix", sm.baseAccessKey[:min(10, len(sm.baseAccessKey))]).Info("Getting new session token")
-
-	// Create STS client with base credentials
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(sm.region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-			sm.baseAccessKey,
-			sm.baseSecretKey,
-			"",
-		)),
-	)
+	if sm.role != nil {
+		creds, err = sm.assumeRole(ctx)
+	} else {
+		creds, err = sm.getSessionToken(ctx)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create AWS config: %w", err)
+		return nil, err
 	}
 
-	stsClient := sts.NewFromConfig(cfg)
+	logger.Log.WithFields(map[string]interface{}{
+		"source":     creds.Source,
+		"expiration": creds.Expiration.Format(time.RFC3339),
+		"validFor":   time.Until(creds.Expiration).String(),
+	}).Info("Successfully obtained new session credentials")
+
+	return creds, nil
+}
+
+func (sm *SessionManager) getSessionToken(ctx context.Context) (*Credentials, error) {
+	logger.Log.Info("Getting new session token")
 
 	// Get session token (valid for 12 hours by default)
 	logger.Log.Debug("Calling AWS STS GetSessionToken")
-	result, err := stsClient.GetSessionToken(context.TODO(), &sts.GetSessionTokenInput{
+	result, err := sm.client.GetSessionToken(ctx, &sts.GetSessionTokenInput{
 		DurationSeconds: aws.Int32(43200), // 12 hours
 	})
 	if err != nil {
 		logger.Log.WithError(err).Error("Failed to get session token")
 		return nil, fmt.Errorf("failed to get session token: %w", err)
 	}
-	
-	sm.currentSession = &SessionCredentials{
-		AccessKeyID:     *result.Credentials.AccessKeyId,
-		SecretAccessKey: *result.Credentials.SecretAccessKey,
-		SessionToken:    *result.Credentials.SessionToken,
-		Expiration:      *result.Credentials.Expiration,
+
+	return fromSTS(result.Credentials, "STS GetSessionToken"), nil
+}
+
+func (sm *SessionManager) assumeRole(ctx context.Context) (*Credentials, error) {
+	role := sm.role
+	log := logger.Log.WithField("roleArn", role.ARN)
+	log.Info("Assuming role")
+
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(role.ARN),
+		RoleSessionName: aws.String(role.SessionName),
+		DurationSeconds: aws.Int32(int32(role.Duration / time.Second)),
+	}
+	if role.ExternalID != "" {
+		input.ExternalId = aws.String(role.ExternalID)
+	}
+	if role.MFASerial != "" {
+		token, err := role.MFAToken(ctx)
+		if err != nil {
+			log.WithError(err).Error("Failed to get MFA token")
+			return nil, fmt.Errorf("failed to get MFA token: %w", err)
+		}
+		input.SerialNumber = aws.String(role.MFASerial)
+		input.TokenCode = aws.String(token)
 	}
-	
-	logger.Log.WithFields(map[string]interface{}{
-		"expiration": sm.currentSession.Expiration.Format(time.RFC3339),
-		"validFor": time.Until(sm.currentSession.Expiration).String(),
-		"accessKeyPrefix": sm.currentSession.AccessKeyID[:10] + "...",
-	}).Info("Successfully obtained new session token")
 
-	return sm.currentSession, nil
+	for _, key := range sortedKeys(role.Tags) {
+		input.Tags = append(input.Tags, types.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(role.Tags[key]),
+		})
+	}
+
+	result, err := sm.client.AssumeRole(ctx, input)
+	if err != nil {
+		log.WithError(err).Error("Failed to assume role")
+		return nil, fmt.Errorf("failed to assume role %s: %w", role.ARN, err)
+	}
+
+	return fromSTS(result.Credentials, "STS AssumeRole"), nil
 }
 
+// fromSTS converts credentials returned by STS.
+func fromSTS(creds *types.Credentials, source string) *Credentials {
+	return &Credentials{
+		AccessKeyID:     aws.ToString(creds.AccessKeyId),
+		SecretAccessKey: aws.ToString(creds.SecretAccessKey),
+		SessionToken:    aws.ToString(creds.SessionToken),
+		Expiration:      aws.ToTime(creds.Expiration),
+		Source:          source,
+	}
+}
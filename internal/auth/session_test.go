@@ -0,0 +1,415 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// stsStub is a local STS endpoint. It answers AssumeRole and
+// GetSessionToken with fresh credentials lasting the requested duration,
+// or with denied when set, and records the requests it got.
+type stsStub struct {
+	*httptest.Server
+	denied bool
+
+	mu       sync.Mutex
+	requests []url.Values
+}
+
+func newSTSStub(t *testing.T) *stsStub {
+	t.Helper()
+	stub := &stsStub{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(stub.serve))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+func (s *stsStub) serve(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r.PostForm)
+	n := len(s.requests)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/xml")
+	if s.denied {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<ErrorResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <Error><Type>Sender</Type><Code>AccessDenied</Code><Message>not authorized to perform sts:AssumeRole</Message></Error>
+  <RequestId>denied</RequestId>
+</ErrorResponse>`)
+		return
+	}
+
+	action := r.PostForm.Get("Action")
+	duration := time.Hour
+	if seconds, err := strconv.Atoi(r.PostForm.Get("DurationSeconds")); err == nil {
+		duration = time.Duration(seconds) * time.Second
+	}
+	expiration := time.Now().Add(duration).UTC().Format(time.RFC3339)
+	fmt.Fprintf(w, `<%[1]sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <%[1]sResult>
+    <Credentials>
+      <AccessKeyId>ASIASTUB%[2]d</AccessKeyId>
+      <SecretAccessKey>stub-secret</SecretAccessKey>
+      <SessionToken>stub-token-%[2]d</SessionToken>
+      <Expiration>%[3]s</Expiration>
+    </Credentials>
+  </%[1]sResult>
+  <ResponseMetadata><RequestId>request-%[2]d</RequestId></ResponseMetadata>
+</%[1]sResponse>`, action, n, expiration)
+}
+
+func (s *stsStub) calls() []url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]url.Values(nil), s.requests...)
+}
+
+// newStubSessionManager returns a session manager whose base credentials
+// are static and whose STS calls go to stub.
+func newStubSessionManager(t *testing.T, stub *stsStub, role *RoleConfig) *SessionManager {
+	t.Helper()
+	t.Setenv("STS_ENDPOINT_URL", stub.URL)
+	cfg := aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKIDBASE", SecretAccessKey: "base-secret", Source: "test"}, nil
+		}),
+		RetryMaxAttempts: 1,
+	}
+	return NewSessionManager(cfg, role)
+}
+
+func TestAssumeRole(t *testing.T) {
+	const arn = "arn:aws:iam::123456789012:role/bedrock"
+
+	tests := []struct {
+		name     string
+		role     RoleConfig
+		denied   bool
+		want     map[string]string
+		absent   []string
+		wantErr  bool
+		wantCall bool
+	}{
+		{
+			name: "role settings are passed to STS",
+			role: RoleConfig{ARN: arn, ExternalID: "ext-42", SessionName: "claude-web", Duration: 30 * time.Minute},
+			want: map[string]string{
+				"Action":          "AssumeRole",
+				"RoleArn":         arn,
+				"RoleSessionName": "claude-web",
+				"DurationSeconds": "1800",
+				"ExternalId":      "ext-42",
+			},
+			absent:   []string{"SerialNumber", "TokenCode"},
+			wantCall: true,
+		},
+		{
+			name: "MFA serial and code are sent",
+			role: RoleConfig{
+				ARN: arn, SessionName: "claude-web", Duration: time.Hour,
+				MFASerial: "arn:aws:iam::123456789012:mfa/ops",
+				MFAToken:  func(ctx context.Context) (string, error) { return "123456", nil },
+			},
+			want: map[string]string{
+				"SerialNumber": "arn:aws:iam::123456789012:mfa/ops",
+				"TokenCode":    "123456",
+			},
+			absent:   []string{"ExternalId"},
+			wantCall: true,
+		},
+		{
+			name: "MFA code comes from the token command",
+			role: RoleConfig{
+				ARN: arn, SessionName: "claude-web", Duration: time.Hour,
+				MFASerial: "arn:aws:iam::123456789012:mfa/ops",
+				MFAToken:  commandTokenSource("printf '654321\\nignored\\n'"),
+			},
+			want:     map[string]string{"TokenCode": "654321"},
+			wantCall: true,
+		},
+		{
+			name: "session tags are sorted",
+			role: RoleConfig{
+				ARN: arn, SessionName: "claude-web", Duration: time.Hour,
+				Tags: map[string]string{"team": "data-eng", "cost-center": "4711"},
+			},
+			want: map[string]string{
+				"Tags.member.1.Key":   "cost-center",
+				"Tags.member.1.Value": "4711",
+				"Tags.member.2.Key":   "team",
+				"Tags.member.2.Value": "data-eng",
+			},
+			wantCall: true,
+		},
+		{
+			name: "a failing MFA token source skips STS",
+			role: RoleConfig{
+				ARN: arn, SessionName: "claude-web", Duration: time.Hour,
+				MFASerial: "arn:aws:iam::123456789012:mfa/ops",
+				MFAToken:  func(ctx context.Context) (string, error) { return "", errors.New("no device") },
+			},
+			wantErr: true,
+		},
+		{
+			name:     "denied AssumeRole fails",
+			role:     RoleConfig{ARN: arn, SessionName: "claude-web", Duration: time.Hour},
+			denied:   true,
+			wantErr:  true,
+			wantCall: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := newSTSStub(t)
+			stub.denied = tt.denied
+			role := tt.role
+			sm := newStubSessionManager(t, stub, &role)
+
+			creds, err := sm.Retrieve(context.Background())
+			calls := stub.calls()
+			if tt.wantCall != (len(calls) == 1) {
+				t.Fatalf("got %d STS calls, want call: %v", len(calls), tt.wantCall)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("got credentials, want an error")
+				}
+				if status := sm.Status(); status.Valid || status.LastError == nil {
+					t.Errorf("got status %+v after a failure", status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for key, value := range tt.want {
+				if got := calls[0].Get(key); got != value {
+					t.Errorf("%s = %q, want %q", key, got, value)
+				}
+			}
+			for _, key := range tt.absent {
+				if calls[0].Has(key) {
+					t.Errorf("%s sent, want it absent", key)
+				}
+			}
+			if creds.AccessKeyID != "ASIASTUB1" || creds.SessionToken != "stub-token-1" || creds.Source != "STS AssumeRole" {
+				t.Errorf("got credentials %+v", creds)
+			}
+			if lifetime := time.Until(creds.Expiration); lifetime < tt.role.Duration-time.Minute || lifetime > tt.role.Duration {
+				t.Errorf("got expiration %s, want %s from now", creds.Expiration, tt.role.Duration)
+			}
+		})
+	}
+}
+
+func TestAssumeRoleMFAOnEveryRefresh(t *testing.T) {
+	stub := newSTSStub(t)
+	codes := 0
+	sm := newStubSessionManager(t, stub, &RoleConfig{
+		ARN:         "arn:aws:iam::123456789012:role/bedrock",
+		SessionName: "claude-web",
+		Duration:    time.Hour,
+		MFASerial:   "arn:aws:iam::123456789012:mfa/ops",
+		MFAToken: func(ctx context.Context) (string, error) {
+			codes++
+			return fmt.Sprintf("%06d", codes), nil
+		},
+	})
+
+	// Cached credentials are served without a new code.
+	for i := 0; i < 2; i++ {
+		if _, err := sm.Retrieve(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	creds, err := sm.Refresh(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := stub.calls()
+	if len(calls) != 2 || codes != 2 {
+		t.Fatalf("got %d STS calls and %d codes, want 2 of each", len(calls), codes)
+	}
+	if calls[0].Get("TokenCode") != "000001" || calls[1].Get("TokenCode") != "000002" {
+		t.Errorf("got codes %q and %q, want a fresh code per call", calls[0].Get("TokenCode"), calls[1].Get("TokenCode"))
+	}
+	if creds.AccessKeyID != "ASIASTUB2" {
+		t.Errorf("got key %s after refresh, want ASIASTUB2", creds.AccessKeyID)
+	}
+}
+
+func TestRefreshDelay(t *testing.T) {
+	stub := newSTSStub(t)
+	sm := newStubSessionManager(t, stub, &RoleConfig{
+		ARN:         "arn:aws:iam::123456789012:role/bedrock",
+		SessionName: "claude-web",
+		Duration:    15 * time.Minute,
+	})
+	if _, err := sm.Retrieve(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A 15 minute credential is renewed with a quarter of its lifetime
+	// left, not every minute.
+	if delay := refreshDelay(sm.Status()); delay < 10*time.Minute || delay > 11*time.Minute+15*time.Second {
+		t.Errorf("got delay %s for a 15m credential, want about 11m15s", delay)
+	}
+
+	now := time.Now()
+	tests := []struct {
+		name   string
+		status CredentialStatus
+		want   time.Duration
+	}{
+		{
+			name:   "long-lived credentials are renewed 30m ahead",
+			status: CredentialStatus{Valid: true, LastRefresh: now, Expiration: now.Add(12 * time.Hour)},
+			want:   11*time.Hour + 30*time.Minute,
+		},
+		{
+			name:   "an hour-long credential is renewed 15m ahead",
+			status: CredentialStatus{Valid: true, LastRefresh: now, Expiration: now.Add(time.Hour)},
+			want:   45 * time.Minute,
+		},
+		{
+			name:   "nearly expired credentials are retried after a minute",
+			status: CredentialStatus{Valid: true, LastRefresh: now.Add(-time.Hour), Expiration: now.Add(time.Minute)},
+			want:   refreshRetry,
+		},
+		{
+			name:   "failures are retried after a minute",
+			status: CredentialStatus{LastError: errors.New("denied")},
+			want:   refreshRetry,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if delay := refreshDelay(tt.status); delay < tt.want-time.Second || delay > tt.want {
+				t.Errorf("got delay %s, want %s", delay, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSessionTokenWithoutRole(t *testing.T) {
+	stub := newSTSStub(t)
+	sm := newStubSessionManager(t, stub, nil)
+
+	creds, err := sm.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := stub.calls()
+	if len(calls) != 1 || calls[0].Get("Action") != "GetSessionToken" || calls[0].Get("DurationSeconds") != "43200" {
+		t.Fatalf("got STS calls %v", calls)
+	}
+	if creds.Source != "STS GetSessionToken" {
+		t.Errorf("got source %s", creds.Source)
+	}
+}
+
+func TestRoleConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    *RoleConfig
+		wantErr bool
+	}{
+		{
+			name: "no role",
+		},
+		{
+			name: "defaults",
+			env:  map[string]string{"BEDROCK_ROLE_ARN": "arn:aws:iam::123456789012:role/bedrock"},
+			want: &RoleConfig{ARN: "arn:aws:iam::123456789012:role/bedrock", SessionName: defaultRoleSessionName, Duration: defaultRoleDuration},
+		},
+		{
+			name: "all settings",
+			env: map[string]string{
+				"BEDROCK_ROLE_ARN":               "arn:aws:iam::123456789012:role/bedrock",
+				"BEDROCK_ROLE_EXTERNAL_ID":       "ext-42",
+				"BEDROCK_ROLE_SESSION_NAME":      "research",
+				"BEDROCK_ROLE_DURATION":          "2h",
+				"BEDROCK_ROLE_MFA_SERIAL":        "arn:aws:iam::123456789012:mfa/ops",
+				"BEDROCK_ROLE_MFA_TOKEN_COMMAND": "echo 123456",
+			},
+			want: &RoleConfig{
+				ARN: "arn:aws:iam::123456789012:role/bedrock", ExternalID: "ext-42", SessionName: "research",
+				Duration: 2 * time.Hour, MFASerial: "arn:aws:iam::123456789012:mfa/ops",
+			},
+		},
+		{
+			name: "MFA serial without a token command",
+			env: map[string]string{
+				"BEDROCK_ROLE_ARN":        "arn:aws:iam::123456789012:role/bedrock",
+				"BEDROCK_ROLE_MFA_SERIAL": "arn:aws:iam::123456789012:mfa/ops",
+			},
+			wantErr: true,
+		},
+		{
+			name: "duration out of range",
+			env: map[string]string{
+				"BEDROCK_ROLE_ARN":      "arn:aws:iam::123456789012:role/bedrock",
+				"BEDROCK_ROLE_DURATION": "5m",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{
+				"BEDROCK_ROLE_ARN", "BEDROCK_ROLE_EXTERNAL_ID", "BEDROCK_ROLE_SESSION_NAME",
+				"BEDROCK_ROLE_DURATION", "BEDROCK_ROLE_MFA_SERIAL", "BEDROCK_ROLE_MFA_TOKEN_COMMAND",
+			} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			role, err := RoleConfigFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %+v, want an error", role)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if role != nil {
+					t.Fatalf("got %+v, want no role", role)
+				}
+				return
+			}
+
+			if (role.MFAToken != nil) != (tt.want.MFASerial != "") {
+				t.Errorf("MFA token source set: %v, want %v", role.MFAToken != nil, tt.want.MFASerial != "")
+			}
+			role.MFAToken = nil
+			if fmt.Sprintf("%+v", *role) != fmt.Sprintf("%+v", *tt.want) {
+				t.Errorf("got %+v, want %+v", *role, *tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// VertexProvider runs claude against Google Vertex AI. Google credentials
+// come from the usual application default credentials, such as
+// GOOGLE_APPLICATION_CREDENTIALS or workload identity, which the CLI reads
+// itself.
+type VertexProvider struct {
+	projectID string
+	region    string
+}
+
+func NewVertexProvider() (*VertexProvider, error) {
+	p := &VertexProvider{
+		projectID: os.Getenv("ANTHROPIC_VERTEX_PROJECT_ID"),
+		region:    os.Getenv("CLOUD_ML_REGION"),
+	}
+	if p.projectID == "" {
+		return nil, fmt.Errorf("the vertex provider needs ANTHROPIC_VERTEX_PROJECT_ID")
+	}
+	if p.region == "" {
+		p.region = "us-east5"
+	}
+	return p, nil
+}
+
+func (p *VertexProvider) Name() string {
+	return ProviderVertex
+}
+
+func (p *VertexProvider) Environment(ctx context.Context, base []string, id *Identity) ([]string, error) {
+	return ReplaceEnv(base, map[string]string{
+		"CLAUDE_CODE_USE_VERTEX":      "1",
+		"ANTHROPIC_VERTEX_PROJECT_ID": p.projectID,
+		"CLOUD_ML_REGION":             p.region,
+	}, providerVariables...), nil
+}
+
+func (p *VertexProvider) DefaultModels() (string, string) {
+	return "claude-sonnet-4@20250514", "claude-3-5-haiku@20241022"
+}
+
+// Status reports valid credentials: the CLI obtains Google tokens on its
+// own, so there is nothing cached here to expire.
+func (p *VertexProvider) Status() CredentialStatus {
+	return CredentialStatus{Valid: true}
+}
@@ -0,0 +1,155 @@
+package claude
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"claude-web-go/internal/logger"
+	"claude-web-go/internal/metrics"
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState string
+
+const (
+	// BreakerClosed lets every request through.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen fails requests fast until the cooldown has passed.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single trial request through; its outcome
+	// closes or reopens the breaker.
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// BreakerStatus is a point-in-time view of a breaker, for health checks.
+type BreakerStatus struct {
+	State               BreakerState
+	ConsecutiveFailures int
+	OpenedAt            time.Time
+	// RetryAt is when an open breaker will let a trial request through.
+	RetryAt time.Time
+}
+
+// Breaker stops sending requests to a backend after consecutive failures,
+// so an outage doesn't pile up claude processes waiting out timeouts.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker opens after threshold consecutive failures and stays open for
+// cooldown before probing.
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	b := &Breaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+	}
+	metrics.SetBreakerState(name, string(BreakerClosed))
+	return b
+}
+
+// allow reports whether a request may go ahead. Every allowed request must
+// be followed by record.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		retryAt := b.openedAt.Add(b.cooldown)
+		if time.Now().Before(retryAt) {
+			return b.rejected(time.Until(retryAt))
+		}
+		b.transition(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing {
+			return b.rejected(b.cooldown)
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record reports the outcome of an allowed request. Outcomes that say
+// nothing about the backend's health, such as a cancelled request, only
+// end a probe.
+func (b *Breaker) record(code ErrorCode) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	probe := b.probing
+	b.probing = false
+
+	switch {
+	case code == "":
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.transition(BreakerClosed)
+		}
+	case backendFailure(code):
+		b.failures++
+		if probe || b.failures >= b.threshold {
+			b.openedAt = time.Now()
+			if b.state != BreakerOpen {
+				b.transition(BreakerOpen)
+			}
+		}
+	}
+}
+
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+	}
+	if b.state != BreakerClosed {
+		status.OpenedAt = b.openedAt
+		status.RetryAt = b.openedAt.Add(b.cooldown)
+	}
+	return status
+}
+
+// transition must be called with b.mu held.
+func (b *Breaker) transition(state BreakerState) {
+	logger.Log.WithFields(map[string]interface{}{
+		"backend":             b.name,
+		"from":                b.state,
+		"to":                  state,
+		"consecutiveFailures": b.failures,
+	}).Warn("Circuit breaker state changed")
+
+	b.state = state
+	metrics.SetBreakerState(b.name, string(state))
+}
+
+// rejected must be called with b.mu held.
+func (b *Breaker) rejected(retryAfter time.Duration) error {
+	metrics.BreakerRejected.WithLabelValues(b.name).Inc()
+	err := newError(ErrServiceDegraded, fmt.Errorf("circuit breaker for %s is %s after %d consecutive failures", b.name, b.state, b.failures))
+	err.RetryAfter = retryAfter
+	return err
+}
+
+// backendFailure reports whether a failure suggests the backend itself is
+// unhealthy, as opposed to a problem with the request or configuration.
+func backendFailure(code ErrorCode) bool {
+	switch code {
+	case ErrThrottled, ErrUnavailable, ErrTimeout, ErrAuthExpired, ErrInternal:
+		return true
+	}
+	return false
+}
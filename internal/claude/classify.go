@@ -0,0 +1,112 @@
+package claude
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// failurePatterns are matched case-insensitively, in order, against the
+// CLI's stderr and the error text of its result event to classify a failed
+// run. stdout is not searched: it streams the conversation, so a run that
+// discusses rate limits or prints "429" would otherwise be misclassified.
+// The CLI passes through provider error names and HTTP statuses; statuses
+// only count next to "status" or "API Error", never as a bare number.
+var failurePatterns = []struct {
+	code     ErrorCode
+	patterns []*regexp.Regexp
+}{
+	{ErrContextTooLong, compilePatterns(
+		`prompt is too long`,
+		`input is too long`,
+		`too many input tokens`,
+		`exceeds? (the )?(model's )?(maximum )?context (length|window)`,
+		`maximum context length`,
+	)},
+	{ErrModelNotEnabled, compilePatterns(
+		`(don't|do not) have access to the model`,
+		`model access is not enabled`,
+		`model not found`,
+		`model identifier is invalid`,
+		`resourcenotfoundexception`,
+		`not_found_error`,
+	)},
+	{ErrAuthExpired, compilePatterns(
+		`expiredtoken`,
+		`security token included in the request is expired`,
+		`security token included in the request is invalid`,
+		`unrecognizedclientexception`,
+		`invalidclienttokenid`,
+		`could not load credentials`,
+		`invalid api key`,
+		`invalid x-api-key`,
+		`authentication_error`,
+		statusPattern(401),
+	)},
+	// Access denied for any other reason, such as a missing IAM
+	// permission, after the model access wording above.
+	{ErrPermissionDenied, compilePatterns(
+		`accessdeniedexception`,
+		`not authorized to perform`,
+		`permission_error`,
+		statusPattern(403),
+	)},
+	{ErrThrottled, compilePatterns(
+		`throttlingexception`,
+		`too many requests`,
+		`too many tokens`,
+		`rate limit exceeded`,
+		`rate_limit_error`,
+		statusPattern(429),
+	)},
+	{ErrUnavailable, compilePatterns(
+		`serviceunavailableexception`,
+		`modelnotreadyexception`,
+		`overloaded_error`,
+		`insufficient capacity`,
+		statusPattern(503),
+		statusPattern(529),
+	)},
+	// MCP failures as the CLI reports them, last so that a provider error
+	// relayed by an MCP server is classified by the provider error.
+	{ErrToolError, compilePatterns(
+		`mcp server "[^"]+"[^\n]*(failed|error|closed)`,
+		`failed to (start|connect to) mcp server`,
+		`mcp error -?\d+:`,
+		`tool_use_error`,
+		`tool execution failed`,
+	)},
+}
+
+// statusPattern matches an HTTP status as the CLI and SDKs print it:
+// "status 429", "statusCode: 429", "status=429" or "API Error: 429".
+func statusPattern(status int) string {
+	return `\b(status( ?code)?|api error)["']?[ :=]+` + strconv.Itoa(status) + `\b`
+}
+
+func compilePatterns(patterns ...string) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		compiled[i] = regexp.MustCompile(`(?i)` + pattern)
+	}
+	return compiled
+}
+
+// classifyFailure inspects a failed run's stderr and the error text of
+// its result event, if it got that far.
+func classifyFailure(stderr, resultError string) ErrorCode {
+	output := stderr + "\n" + resultError
+	for _, entry := range failurePatterns {
+		for _, pattern := range entry.patterns {
+			if pattern.MatchString(output) {
+				return entry.code
+			}
+		}
+	}
+	return ErrInternal
+}
+
+// retryElsewhere reports whether another region might succeed where this
+// failure happened.
+func retryElsewhere(code ErrorCode) bool {
+	return code == ErrThrottled || code == ErrUnavailable
+}
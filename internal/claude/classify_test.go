@@ -0,0 +1,61 @@
+package claude
+
+import "testing"
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		stderr      string
+		resultError string
+		want        ErrorCode
+	}{
+		{
+			name:   "model access",
+			stderr: "AccessDeniedException: You don't have access to the model with the specified model ID.",
+			want:   ErrModelNotEnabled,
+		},
+		{
+			name:   "missing IAM permission",
+			stderr: "AccessDeniedException: User: arn:aws:sts::123456789012:assumed-role/bedrock/claude-web is not authorized to perform: bedrock:InvokeModelWithResponseStream",
+			want:   ErrPermissionDenied,
+		},
+		{
+			name:        "anthropic permission error",
+			resultError: `API Error: 403 {"type":"error","error":{"type":"permission_error","message":"Your API key does not have permission to use the specified resource."}}`,
+			want:        ErrPermissionDenied,
+		},
+		{
+			name:   "expired token",
+			stderr: "ExpiredTokenException: The security token included in the request is expired",
+			want:   ErrAuthExpired,
+		},
+		{
+			name:   "MCP server failed to start",
+			stderr: `[ERROR] MCP server "diagram" Connection failed: spawn diagram-server ENOENT`,
+			want:   ErrToolError,
+		},
+		{
+			name:        "MCP protocol error",
+			resultError: "MCP error -32000: Connection closed",
+			want:        ErrToolError,
+		},
+		{
+			name:   "provider error relayed by an MCP server",
+			stderr: `MCP server "bedrock-kb" error: ThrottlingException: Rate exceeded`,
+			want:   ErrThrottled,
+		},
+		{
+			name:   "mention of MCP servers",
+			stderr: "warning: 2 mcp servers configured, connection to the model closed unexpectedly",
+			want:   ErrInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyFailure(tt.stderr, tt.resultError); got != tt.want {
+				t.Errorf("classifyFailure() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
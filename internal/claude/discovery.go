@@ -0,0 +1,161 @@
+package claude
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"claude-web-go/internal/config"
+	"claude-web-go/internal/filetype"
+	"claude-web-go/internal/models"
+)
+
+// Reasons reported for output files that were not returned.
+const (
+	SkipIgnored       = "ignored"
+	SkipTooLarge      = "too_large"
+	SkipFileLimit     = "file_limit"
+	SkipTotalSize     = "total_size_limit"
+	SkipNotRegular    = "not_regular"
+	SkipUnreadable    = "unreadable"
+	defaultIgnoreList = ".*,node_modules,__pycache__,*.pyc,*.swp,*~"
+)
+
+// OutputLimits bounds what a single turn may return from its session
+// directory.
+type OutputLimits struct {
+	MaxFiles     int
+	MaxFileSize  int64
+	MaxTotalSize int64
+	// Ignore holds glob patterns matched against each path segment and
+	// against the full slash-separated relative path.
+	Ignore []string
+}
+
+// OutputLimitsFromEnv reads the limits from CLAUDE_MAX_OUTPUT_FILES,
+// CLAUDE_MAX_OUTPUT_FILE_SIZE, CLAUDE_MAX_OUTPUT_TOTAL_SIZE and
+// CLAUDE_OUTPUT_IGNORE, falling back to defaults for unset or invalid values.
+func OutputLimitsFromEnv() OutputLimits {
+	limits := OutputLimits{
+		MaxFiles:     config.Int("CLAUDE_MAX_OUTPUT_FILES", 50),
+		MaxFileSize:  int64(config.Int("CLAUDE_MAX_OUTPUT_FILE_SIZE", 25<<20)),
+		MaxTotalSize: int64(config.Int("CLAUDE_MAX_OUTPUT_TOTAL_SIZE", 100<<20)),
+	}
+
+	ignore, ok := os.LookupEnv("CLAUDE_OUTPUT_IGNORE")
+	if !ok {
+		ignore = defaultIgnoreList
+	}
+	for _, pattern := range strings.Split(ignore, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			limits.Ignore = append(limits.Ignore, pattern)
+		}
+	}
+
+	return limits
+}
+
+func (l OutputLimits) ignored(relPath string) bool {
+	for _, pattern := range l.Ignore {
+		if ok, _ := path.Match(pattern, relPath); ok {
+			return true
+		}
+		for _, segment := range strings.Split(relPath, "/") {
+			if ok, _ := path.Match(pattern, segment); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scanForFiles walks dir recursively and returns the files Claude produced,
+// named by their slash-separated path relative to dir. Files that are
+// ignored or exceed the limits are reported separately with a reason.
+func (e *Executor) scanForFiles(dir string) ([]models.File, []models.SkippedFile, error) {
+	var files []models.File
+	var skipped []models.SkippedFile
+	var totalSize int64
+
+	err := filepath.WalkDir(dir, func(fullPath string, entry fs.DirEntry, err error) error {
+		if fullPath == dir {
+			return err
+		}
+
+		rel, relErr := filepath.Rel(dir, fullPath)
+		if relErr != nil {
+			return relErr
+		}
+		rel = filepath.ToSlash(rel)
+
+		if err != nil {
+			skipped = append(skipped, models.SkippedFile{Name: rel, Reason: SkipUnreadable})
+			if entry != nil && entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if e.outputLimits.ignored(rel) {
+			if entry.IsDir() {
+				skipped = append(skipped, models.SkippedFile{Name: rel + "/", Reason: SkipIgnored})
+				return fs.SkipDir
+			}
+			skipped = append(skipped, models.SkippedFile{Name: rel, Reason: SkipIgnored})
+			return nil
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			skipped = append(skipped, models.SkippedFile{Name: rel, Reason: SkipUnreadable})
+			return nil
+		}
+
+		// Symlinks could point anywhere on the host, so only regular files
+		// are ever returned.
+		if !info.Mode().IsRegular() {
+			skipped = append(skipped, models.SkippedFile{Name: rel, Size: info.Size(), Reason: SkipNotRegular})
+			return nil
+		}
+
+		switch {
+		case info.Size() > e.outputLimits.MaxFileSize:
+			skipped = append(skipped, models.SkippedFile{Name: rel, Size: info.Size(), Reason: SkipTooLarge})
+			return nil
+		case len(files) >= e.outputLimits.MaxFiles:
+			skipped = append(skipped, models.SkippedFile{Name: rel, Size: info.Size(), Reason: SkipFileLimit})
+			return nil
+		case totalSize+info.Size() > e.outputLimits.MaxTotalSize:
+			skipped = append(skipped, models.SkippedFile{Name: rel, Size: info.Size(), Reason: SkipTotalSize})
+			return nil
+		}
+
+		fileType, err := filetype.DetectFile(fullPath)
+		if err != nil {
+			skipped = append(skipped, models.SkippedFile{Name: rel, Size: info.Size(), Reason: SkipUnreadable})
+			return nil
+		}
+
+		totalSize += info.Size()
+		files = append(files, models.File{
+			Name:        rel,
+			Path:        fullPath,
+			Size:        info.Size(),
+			MimeType:    fileType.MimeType,
+			Previewable: fileType.Previewable,
+			Language:    fileType.Language,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return files, skipped, nil
+}
@@ -0,0 +1,119 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// ErrorCode identifies a class of execution failure. Codes are part of the
+// API and must not change.
+type ErrorCode string
+
+const (
+	ErrAuthExpired      ErrorCode = "auth_expired"
+	ErrThrottled        ErrorCode = "throttled"
+	ErrUnavailable      ErrorCode = "unavailable"
+	ErrModelNotEnabled  ErrorCode = "model_not_enabled"
+	ErrPermissionDenied ErrorCode = "permission_denied"
+	ErrTimeout          ErrorCode = "timeout"
+	ErrContextTooLong   ErrorCode = "context_too_long"
+	ErrToolError        ErrorCode = "tool_error"
+	ErrCLIMissing       ErrorCode = "cli_missing"
+	ErrCancelled        ErrorCode = "cancelled"
+	ErrServiceDegraded  ErrorCode = "service_degraded"
+	ErrInvalidRequest   ErrorCode = "invalid_request"
+	ErrInternal         ErrorCode = "internal"
+)
+
+// errorInfo is the user-facing description of each code.
+var errorInfo = map[ErrorCode]struct {
+	message   string
+	retryable bool
+}{
+	ErrAuthExpired:      {"The server's model credentials have expired or are invalid. Please contact the administrator.", false},
+	ErrThrottled:        {"The model is receiving too many requests right now. Please try again shortly.", true},
+	ErrUnavailable:      {"The model is temporarily unavailable. Please try again shortly.", true},
+	ErrModelNotEnabled:  {"The configured model is not available to this server. Please contact the administrator.", false},
+	ErrPermissionDenied: {"The server's model credentials are not allowed to use the model. Please contact the administrator.", false},
+	ErrTimeout:          {"The model took too long to respond.", true},
+	ErrContextTooLong:   {"The conversation is too long for the model. Start a new conversation or shorten the context window.", false},
+	ErrToolError:        {"A tool used by the model failed.", true},
+	ErrCLIMissing:       {"The server is not set up to run the model. Please contact the administrator.", false},
+	ErrCancelled:        {"The request was cancelled.", false},
+	ErrServiceDegraded:  {"The model service is degraded after repeated failures. Please try again in a minute.", true},
+	ErrInvalidRequest:   {"The request is invalid.", false},
+	ErrInternal:         {"Something went wrong while running the model.", true},
+}
+
+// ExecutionError is a classified execution failure. Error() includes the
+// underlying cause for logs; Message is safe to show to users.
+type ExecutionError struct {
+	Code      ErrorCode
+	Message   string
+	Retryable bool
+	// Attempts is how many times claude was run before giving up.
+	Attempts int
+	// RetryAfter, if set, is how long the client should wait before
+	// trying again.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ExecutionError) Error() string {
+	if e.Err == nil {
+		return string(e.Code)
+	}
+	return fmt.Sprintf("%s: %v", e.Code, e.Err)
+}
+
+func (e *ExecutionError) Unwrap() error {
+	return e.Err
+}
+
+// newError wraps err with the standard message for code.
+func newError(code ErrorCode, err error) *ExecutionError {
+	info := errorInfo[code]
+	return &ExecutionError{
+		Code:      code,
+		Message:   info.message,
+		Retryable: info.retryable,
+		Err:       err,
+	}
+}
+
+func withAttempts(err *ExecutionError, attempts int) *ExecutionError {
+	err.Attempts = attempts
+	return err
+}
+
+// invalidRequest reports a problem with the request itself, whose
+// description is safe to show.
+func invalidRequest(format string, args ...interface{}) *ExecutionError {
+	err := fmt.Errorf(format, args...)
+	e := newError(ErrInvalidRequest, err)
+	e.Message = err.Error()
+	return e
+}
+
+// AsExecutionError returns err as an ExecutionError, classifying errors
+// that aren't one already.
+func AsExecutionError(err error) *ExecutionError {
+	var execErr *ExecutionError
+	if errors.As(err, &execErr) {
+		return execErr
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return newError(ErrCancelled, err)
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, errTimedOut):
+		return newError(ErrTimeout, err)
+	case errors.Is(err, exec.ErrNotFound):
+		return newError(ErrCLIMissing, err)
+	default:
+		return newError(ErrInternal, err)
+	}
+}
@@ -3,6 +3,7 @@ package claude
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -11,27 +12,85 @@ import (
 	"time"
 
 	"claude-web-go/internal/auth"
+	"claude-web-go/internal/config"
 	"claude-web-go/internal/logger"
+	"claude-web-go/internal/metrics"
 	"claude-web-go/internal/models"
+	"claude-web-go/internal/tracing"
 
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// errTimedOut is returned when a claude run exceeds its timeout.
+var errTimedOut = errors.New("claude command timed out")
+
+var tracer = tracing.Tracer("claude")
+
 type Executor struct {
-	tmpDir    string
-	awsConfig *auth.AWSConfig
+	tmpDir       string
+	providers    map[string]auth.LLMProvider
+	profiles     map[string]Profile
+	retry        RetryPolicy
+	breakers     map[string]*Breaker
+	maxTimeout   time.Duration
+	killGrace    time.Duration
+	outputLimits OutputLimits
+}
+
+// Result is the outcome of a single claude invocation.
+type Result struct {
+	Output  string
+	Files   []models.File
+	Skipped []models.SkippedFile
+	// Status is models.StatusCompleted, or models.StatusTimedOut when the
+	// output and files are what was produced before the deadline.
+	Status string
+	// Metadata records where the run was served.
+	Metadata models.ResponseMetadata
 }
 
 func NewExecutor() (*Executor, error) {
-	awsConfig, err := auth.GetAWSConfig()
+	profiles, err := LoadProfiles()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get AWS config: %w", err)
+		return nil, err
 	}
 
-	if err := auth.SetupEnvironment(awsConfig); err != nil {
-		return nil, fmt.Errorf("failed to setup AWS environment: %w", err)
+	// Set up each provider some profile uses, and fill in its default
+	// models where a profile leaves them out.
+	providers := make(map[string]auth.LLMProvider)
+	for name, profile := range profiles {
+		provider, ok := providers[profile.Provider]
+		if !ok {
+			provider, err = auth.NewLLMProvider(context.Background(), profile.Provider)
+			if err != nil {
+				return nil, fmt.Errorf("failed to set up %s provider: %w", profile.Provider, err)
+			}
+			providers[profile.Provider] = provider
+		}
+
+		model, smallFastModel := provider.DefaultModels()
+		if profile.Model == "" {
+			profile.Model = model
+		}
+		if profile.SmallFastModel == "" {
+			profile.SmallFastModel = smallFastModel
+		}
+		if err := profile.resolveTargets(); err != nil {
+			return nil, err
+		}
+		profiles[name] = profile
 	}
 
+	logger.Log.WithFields(map[string]interface{}{
+		"provider": profiles[""].Provider,
+		"model":    profiles[""].Model,
+		"regions":  profiles[""].Targets,
+		"profiles": profileNames(profiles),
+	}).Info("LLM providers configured")
+
 	// Check if /tmp exists and is writable
 	tmpDir := "/tmp"
 	if stat, err := os.Stat(tmpDir); err != nil {
@@ -89,163 +148,141 @@ func NewExecutor() (*Executor, error) {
 		}
 	}
 
-	// Log environment variables that claude might need
+	outputLimits := OutputLimitsFromEnv()
 	logger.Log.WithFields(map[string]interface{}{
-		"AWS_REGION": os.Getenv("AWS_REGION"),
-		"AWS_ACCESS_KEY_ID_exists": os.Getenv("AWS_ACCESS_KEY_ID") != "",
-		"AWS_SECRET_ACCESS_KEY_exists": os.Getenv("AWS_SECRET_ACCESS_KEY") != "",
-		"AWS_SESSION_TOKEN_exists": os.Getenv("AWS_SESSION_TOKEN") != "",
-		"CLAUDE_CODE_USE_BEDROCK": os.Getenv("CLAUDE_CODE_USE_BEDROCK"),
-		"ANTHROPIC_MODEL": os.Getenv("ANTHROPIC_MODEL"),
-		"ANTHROPIC_SMALL_FAST_MODEL": os.Getenv("ANTHROPIC_SMALL_FAST_MODEL"),
-		"ANTHROPIC_API_KEY": os.Getenv("ANTHROPIC_API_KEY"),
-		"ANTHROPIC_ENDPOINT_URL": os.Getenv("ANTHROPIC_ENDPOINT_URL"),
-		"HOME": os.Getenv("HOME"),
-	}).Info("Environment variables before claude test")
-
-	// First test without AWS credentials to see if it still tries to connect
-	logger.Log.Info("Testing if claude uses Bedrock...")
-	testEnv := []string{
-		"PATH=" + os.Getenv("PATH"),
-		"HOME=" + os.Getenv("HOME"),
-		"CLAUDE_CODE_USE_BEDROCK=1",
-		"ANTHROPIC_MODEL=" + os.Getenv("ANTHROPIC_MODEL"),
-	}
-	noCredsCmd := exec.Command("claude", "--version")
-	noCredsCmd.Env = testEnv
-	if output, err := noCredsCmd.CombinedOutput(); err != nil {
-		logger.Log.WithError(err).WithField("output", string(output)).Debug("Claude version without AWS creds")
-	}
-
-	// Now test with a prompt but no AWS credentials - should fail if using Bedrock
-	noCredsTestCmd := exec.Command("claude", "-p", "Hi")
-	noCredsTestCmd.Env = testEnv
-	if output, err := noCredsTestCmd.CombinedOutput(); err != nil {
-		outputStr := string(output)
-		if strings.Contains(outputStr, "AWS") || strings.Contains(outputStr, "credentials") {
-			logger.Log.Info("Good: Claude appears to need AWS credentials (using Bedrock)")
-		} else if strings.Contains(outputStr, "429") || strings.Contains(outputStr, "API key") {
-			logger.Log.Error("BAD: Claude still trying to use Anthropic API without AWS credentials!")
-		}
-		logger.Log.WithField("output", outputStr).Debug("Claude test without AWS creds")
-	}
-
-	// Test a simple claude command with timeout
-	logger.Log.Info("Testing claude command with full credentials...")
-	
-	// First test without MCP to isolate issues
-	logger.Log.Info("Testing without MCP config first...")
-	simpleCtx, simpleCancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer simpleCancel()
-	
-	simpleArgs := []string{}
-	if model := os.Getenv("ANTHROPIC_MODEL"); model != "" {
-		simpleArgs = append(simpleArgs, "--model", model)
-	}
-	simpleArgs = append(simpleArgs, "-p", "Say hello")
-	
-	simpleCmd := exec.CommandContext(simpleCtx, "claude", simpleArgs...)
-	simpleCmd.Env = os.Environ()
-	
-	// Log the exact command being run
-	logger.Log.WithFields(map[string]interface{}{
-		"command": "claude",
-		"args": simpleArgs,
-		"envCount": len(simpleCmd.Env),
-	}).Debug("Running simple test command")
-	
-	var simpleStdout, simpleStderr bytes.Buffer
-	simpleCmd.Stdout = &simpleStdout
-	simpleCmd.Stderr = &simpleStderr
-	
-	if err := simpleCmd.Run(); err != nil {
-		logger.Log.WithError(err).WithFields(map[string]interface{}{
-			"stderr": simpleStderr.String(),
-			"stdout": simpleStdout.String(),
-		}).Warn("Simple test failed")
-	} else {
-		logger.Log.WithField("output", simpleStdout.String()).Info("Simple test succeeded - MCP might be the issue")
-	}
-	
-	// Now test with full configuration
-	testCtx, testCancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer testCancel()
+		"maxFiles":     outputLimits.MaxFiles,
+		"maxFileSize":  outputLimits.MaxFileSize,
+		"maxTotalSize": outputLimits.MaxTotalSize,
+		"ignore":       outputLimits.Ignore,
+	}).Info("Output discovery limits")
 
-	// Build test args
-	testArgs := []string{}
-	if os.Getenv("LOG_LEVEL") == "debug" {
-		testArgs = append(testArgs, "--debug")
-	}
-	if model := os.Getenv("ANTHROPIC_MODEL"); model != "" {
-		testArgs = append(testArgs, "--model", model)
-	}
-	if allowedTools := os.Getenv("CLAUDE_ALLOWED_TOOLS"); allowedTools != "" {
-		testArgs = append(testArgs, "--allowedTools", allowedTools)
-	}
-	// Disallowed tools with default if not set
-	disallowedTools := os.Getenv("CLAUDE_DISALLOWED_TOOLS")
-	if disallowedTools == "" {
-		disallowedTools = "Bash,Glob,Grep,LS,Read,Edit,MultiEdit,Write,NotebookRead,NotebookEdit,WebFetch,TodoRead,TodoWrite,Task"
+	retry := RetryPolicyFromEnv()
+	// Give every region a chance before giving up.
+	for _, profile := range profiles {
+		retry.MaxAttempts = max(retry.MaxAttempts, len(profile.Targets))
 	}
-	testArgs = append(testArgs, "--disallowedTools", disallowedTools)
-	// MCP config support for test
-	if mcpConfig := os.Getenv("CLAUDE_MCP_CONFIG"); mcpConfig != "" {
-		logger.Log.WithField("mcp_config_test", mcpConfig).Debug("Adding MCP config to test command")
-		testArgs = append(testArgs, "--mcp-config", mcpConfig)
+	logger.Log.WithFields(map[string]interface{}{
+		"maxAttempts": retry.MaxAttempts,
+		"baseDelay":   retry.BaseDelay.String(),
+		"maxDelay":    retry.MaxDelay.String(),
+		"budget":      retry.Budget.String(),
+	}).Info("Retry policy")
+
+	timeout := config.Duration("CLAUDE_TIMEOUT", 5*time.Minute)
+	maxTimeout := config.Duration("CLAUDE_MAX_TIMEOUT", 30*time.Minute)
+	for name, profile := range profiles {
+		if profile.timeout == 0 {
+			profile.timeout = timeout
+			profiles[name] = profile
+		}
 	}
-	testArgs = append(testArgs, "-p", "Say hello")
-
-	logger.Log.WithField("testArgs", testArgs).Debug("Running test command")
-
-	testCmd := exec.CommandContext(testCtx, "claude", testArgs...)
-	testCmd.Env = os.Environ()
-
-	// Capture stdout and stderr separately for better debugging
-	var testStdout, testStderr bytes.Buffer
-	testCmd.Stdout = &testStdout
-	testCmd.Stderr = &testStderr
+	logger.Log.WithFields(map[string]interface{}{
+		"timeout":    timeout.String(),
+		"maxTimeout": maxTimeout.String(),
+	}).Info("Execution timeouts")
+
+	threshold := config.Int("CLAUDE_BREAKER_THRESHOLD", 5)
+	cooldown := config.Duration("CLAUDE_BREAKER_COOLDOWN", 30*time.Second)
+	breakers := make(map[string]*Breaker, len(providers))
+	for name := range providers {
+		breakers[name] = NewBreaker(name, threshold, cooldown)
+	}
+
+	e := &Executor{
+		tmpDir:       tmpDir,
+		providers:    providers,
+		profiles:     profiles,
+		retry:        retry,
+		breakers:     breakers,
+		maxTimeout:   maxTimeout,
+		killGrace:    config.Duration("CLAUDE_KILL_GRACE", 5*time.Second),
+		outputLimits: outputLimits,
+	}
+	e.warmUp()
+
+	return e, nil
+}
 
-	err = testCmd.Run()
+// Execute runs a chat request with the profile it names and the
+// credentials of the caller identified in ctx, if any. Errors are always
+// *ExecutionError.
+func (e *Executor) Execute(ctx context.Context, req models.ChatRequest) (result *Result, err error) {
+	ctx, span := tracer.Start(ctx, "claude.execute", trace.WithAttributes(
+		attribute.String("session.id", req.SessionID),
+	))
+	defer func() {
+		if result != nil {
+			span.SetAttributes(attribute.Int("claude.attempts", result.Metadata.Attempts))
+		}
+		tracing.End(span, err)
+	}()
 
-	// Always log any output we got
-	if testStderr.Len() > 0 {
-		logger.Log.WithField("stderr", testStderr.String()).Warn("Test command stderr")
-	}
-	if testStdout.Len() > 0 {
-		logger.Log.WithField("stdout", testStdout.String()).Info("Test command stdout")
+	profile, err := e.profile(req.Profile)
+	if err != nil {
+		return nil, err
 	}
+	span.SetAttributes(
+		attribute.String("claude.profile", profile.Name),
+		attribute.String("claude.provider", profile.Provider),
+		attribute.String("claude.model", profile.Model),
+	)
 
-	if testCtx.Err() == context.DeadlineExceeded {
-		logger.Log.Error("Claude test command timed out after 10 seconds")
-		logger.Log.Warn("Claude may not be working properly - continuing anyway")
-	} else if err != nil {
-		logger.Log.WithError(err).Error("Claude test command failed")
-		logger.Log.Warn("Claude may not be working properly - continuing anyway")
-	} else {
-		logger.Log.Info("Claude test command succeeded")
+	// Fail fast while the provider is known to be failing.
+	breaker := e.breakers[profile.Provider]
+	if err := breaker.allow(); err != nil {
+		execErr := AsExecutionError(err)
+		metrics.RecordRun(string(execErr.Code), profile.Model, 0)
+		return nil, execErr
 	}
 
-	return &Executor{
-		tmpDir:    tmpDir,
-		awsConfig: awsConfig,
-	}, nil
+	metrics.ExecutorInFlight.Inc()
+	defer metrics.ExecutorInFlight.Dec()
+
+	callerDeadline := e.callerDeadline(ctx, profile, req)
+	result, err = e.execute(ctx, req, profile)
+	if err != nil {
+		execErr := AsExecutionError(err)
+		code := execErr.Code
+		if code == ErrTimeout && callerDeadline {
+			// The caller chose a shorter deadline than the profile's, so
+			// running out of time says nothing about the backend.
+			code = ErrCancelled
+		}
+		breaker.record(code)
+		metrics.RecordRun(string(execErr.Code), profile.Model, execErr.Attempts)
+		return result, execErr
+	}
+	breaker.record("")
+	metrics.RecordRun("ok", result.Metadata.Model, result.Metadata.Attempts)
+	return result, nil
 }
 
-func (e *Executor) Execute(prompt string, contextWindow []models.Message) (string, []models.File, error) {
-	sessionID := uuid.New().String()
-	sessionDir := filepath.Join(e.tmpDir, sessionID)
+func (e *Executor) execute(ctx context.Context, req models.ChatRequest, profile Profile) (*Result, error) {
+	provider := e.providers[profile.Provider]
+
+	// Every run gets a directory of its own, even within one conversation,
+	// so concurrent requests don't see each other's files.
+	runID := uuid.New().String()
+	sessionDir := filepath.Join(e.tmpDir, runID)
 
-	log := logger.Log.WithField("sessionID", sessionID)
+	log := logger.FromContext(ctx).WithFields(map[string]interface{}{
+		"sessionID": req.SessionID,
+		"runID":     runID,
+	})
+	identity := auth.IdentityFromContext(ctx)
+	if identity != nil {
+		log = log.WithField("user", identity.User)
+	}
 
 	log.WithField("sessionDir", sessionDir).Debug("Creating session directory")
 	if err := os.MkdirAll(sessionDir, 0755); err != nil {
-		return "", nil, fmt.Errorf("failed to create session directory: %w", err)
+		return nil, fmt.Errorf("failed to create session directory: %w", err)
 	}
 
 	// Verify directory was created
 	if stat, err := os.Stat(sessionDir); err != nil {
 		log.WithError(err).Error("Failed to stat session directory after creation")
-		return "", nil, fmt.Errorf("session directory not found after creation: %w", err)
+		return nil, fmt.Errorf("session directory not found after creation: %w", err)
 	} else {
 		log.WithFields(map[string]interface{}{
 			"sessionDir": sessionDir,
@@ -257,56 +294,214 @@ func (e *Executor) Execute(prompt string, contextWindow []models.Message) (strin
 	// Don't cleanup immediately - let the system handle /tmp cleanup
 	// This allows the UI to fetch files without race conditions
 
-	fullPrompt := e.buildPromptWithContext(prompt, contextWindow)
+	fullPrompt := e.buildPromptWithContext(req.Message, req.ContextWindow)
+
+	// The deadline covers every attempt of the request.
+	timeout := e.timeoutFor(profile, req)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	// Log the command we're about to run
-	awsKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
-	awsKeyPrefix := ""
-	if len(awsKeyID) > 10 {
-		awsKeyPrefix = awsKeyID[:10] + "..."
+	childEnv, err := e.environment(ctx, provider, profile, identity)
+	if err != nil {
+		log.WithError(err).Error("Failed to get provider credentials")
+		return nil, newError(ErrAuthExpired, err)
 	}
 
 	log.WithFields(map[string]interface{}{
-		"directory":                sessionDir,
-		"CLAUDE_CODE_USE_BEDROCK":  os.Getenv("CLAUDE_CODE_USE_BEDROCK"),
-		"ANTHROPIC_MODEL":          os.Getenv("ANTHROPIC_MODEL"),
-		"AWS_REGION":               os.Getenv("AWS_REGION"),
-		"AWS_ACCESS_KEY_ID_prefix": awsKeyPrefix,
-		"AWS_SESSION_TOKEN_exists": os.Getenv("AWS_SESSION_TOKEN") != "",
-		"promptLength":             len(fullPrompt),
+		"directory":    sessionDir,
+		"profile":      profile.Name,
+		"provider":     profile.Provider,
+		"model":        profile.Model,
+		"timeout":      timeout.String(),
+		"promptLength": len(fullPrompt),
 	}).Info("Executing claude command")
 
-	// Build command args
-	args := []string{}
-	if os.Getenv("LOG_LEVEL") == "debug" {
-		args = append(args, "--debug")
+	// Transient failures are retried with backoff until the attempt limit
+	// or the time budget runs out. Each target is a region, possibly with
+	// its own inference profile; throttling and capacity errors move on to
+	// the next one.
+	var stdout *capture
+	var stderr string
+	var attempt Profile
+	var lastCode ErrorCode
+	var lastErr error
+	timedOut := false
+	attempts := 0
+	start := time.Now()
+	targetIndex := 0
+	for {
+		target := profile.Targets[targetIndex]
+		attempt = profile.forTarget(target)
+		attemptLog := log.WithField("attempt", attempts+1)
+		if target.Region != "" {
+			attemptLog = attemptLog.WithField("region", target.Region)
+		}
+
+		if attempts > 0 {
+			backoff := e.retry.delay(attempts)
+			if time.Since(start)+backoff > e.retry.Budget {
+				attemptLog.Warn("Retry budget exhausted")
+				return nil, withAttempts(newError(lastCode, lastErr), attempts)
+			}
+
+			attemptLog.WithField("backoff", backoff.String()).Warn("Retrying claude command")
+			select {
+			case <-ctx.Done():
+				return nil, withAttempts(AsExecutionError(ctx.Err()), attempts)
+			case <-time.After(backoff):
+			}
+
+			// Start from an empty directory so files written by the failed
+			// attempt aren't returned.
+			if err := resetDir(sessionDir); err != nil {
+				return nil, fmt.Errorf("failed to reset session directory: %w", err)
+			}
+			metrics.ExecutorRetries.Inc()
+		}
+		attempts++
+
+		env := childEnv
+		if attempts > 1 || attempt.Model != profile.Model {
+			env, err = e.environment(ctx, provider, attempt, identity)
+			if err != nil {
+				attemptLog.WithError(err).Error("Failed to get provider credentials")
+				return nil, newError(ErrAuthExpired, err)
+			}
+		}
+		if target.Region != "" {
+			env = auth.ReplaceEnv(env, map[string]string{"AWS_REGION": target.Region})
+		}
+
+		started := time.Now()
+		stdout, stderr, err = e.run(ctx, attemptLog, sessionDir, commandArgs(attempt, fullPrompt), env, attempts, target.Region)
+		if err == nil {
+			recordAttempt("ok", started)
+			break
+		}
+		if errors.Is(err, context.Canceled) {
+			recordAttempt(string(ErrCancelled), started)
+			return nil, withAttempts(newError(ErrCancelled, err), attempts)
+		}
+
+		lastCode = ErrTimeout
+		if !errors.Is(err, errTimedOut) {
+			lastCode = classifyFailure(stderr, parseOutput(stdout, time.Now()).errorText)
+		}
+		// stderr can carry conversation content, so it is only logged as a
+		// content field, never folded into the error.
+		lastErr = fmt.Errorf("claude execution failed after %d attempt(s): %w", attempts, err)
+		recordAttempt(string(lastCode), started)
+		attemptLog.WithError(err).WithFields(map[string]interface{}{
+			"stderr":    stderr,
+			"errorCode": lastCode,
+		}).Error("Claude execution failed")
+
+		if lastCode == ErrTimeout {
+			// Keep what the run produced before it was stopped.
+			timedOut = true
+			break
+		}
+		if !retryable(lastCode) || attempts >= e.retry.MaxAttempts {
+			return nil, withAttempts(newError(lastCode, lastErr), attempts)
+		}
+		if retryElsewhere(lastCode) {
+			targetIndex = (targetIndex + 1) % len(profile.Targets)
+		}
 	}
-	if model := os.Getenv("ANTHROPIC_MODEL"); model != "" {
-		args = append(args, "--model", model)
+
+	out := e.parse(ctx, stdout)
+	if out.usage != nil {
+		out.usage.record(attempt.Model)
 	}
-	if allowedTools := os.Getenv("CLAUDE_ALLOWED_TOOLS"); allowedTools != "" {
-		args = append(args, "--allowedTools", allowedTools)
+
+	log.Debug("Scanning for output files")
+	files, skipped, err := e.scanForFiles(sessionDir)
+	if err != nil {
+		log.WithError(err).Warn("Failed to scan for files")
+		return &Result{Output: out.text}, err
+	}
+
+	if len(skipped) > 0 {
+		log.WithField("skipped", skipped).Info("Some output files were not returned")
+	}
+	if !timedOut {
+		log.WithField("fileCount", len(files)).Info("Claude execution completed successfully")
+	}
+
+	result := &Result{
+		Output:  out.text,
+		Files:   files,
+		Skipped: skipped,
+		Status:  models.StatusCompleted,
+		Metadata: models.ResponseMetadata{
+			Profile:  attempt.Name,
+			Provider: attempt.Provider,
+			Model:    attempt.Model,
+			Region:   attempt.region,
+			Attempts: attempts,
+		},
+	}
+	if out.usage != nil {
+		result.Metadata.Usage = &models.Usage{
+			InputTokens:  out.usage.InputTokens,
+			OutputTokens: out.usage.OutputTokens,
+			CostUSD:      out.usage.costUSD,
+		}
 	}
-	// Disallowed tools with default if not set
-	disallowedTools := os.Getenv("CLAUDE_DISALLOWED_TOOLS")
-	if disallowedTools == "" {
-		disallowedTools = "Bash,Glob,Grep,LS,Read,Edit,MultiEdit,Write,NotebookRead,NotebookEdit,WebFetch,TodoRead,TodoWrite,Task"
+	if timedOut {
+		log.WithField("fileCount", len(files)).Warn("Returning partial output after timeout")
+		result.Status = models.StatusTimedOut
+		return result, withAttempts(newError(ErrTimeout, lastErr), attempts)
 	}
-	args = append(args, "--disallowedTools", disallowedTools)
-	// MCP config support
-	if mcpConfig := os.Getenv("CLAUDE_MCP_CONFIG"); mcpConfig != "" {
-		logger.Log.WithField("mcp_config", mcpConfig).Debug("Adding MCP config to command")
-		args = append(args, "--mcp-config", mcpConfig)
+	return result, nil
+}
+
+// timeoutFor returns the deadline for a request: the profile's timeout,
+// or the one the client asked for, capped at the server maximum.
+func (e *Executor) timeoutFor(profile Profile, req models.ChatRequest) time.Duration {
+	if req.TimeoutSeconds <= 0 {
+		return profile.timeout
+	}
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	if timeout > e.maxTimeout {
+		return e.maxTimeout
 	}
-	args = append(args, "-p", fullPrompt)
+	return timeout
+}
 
-	cmd := exec.Command("claude", args...)
-	cmd.Dir = sessionDir
-	cmd.Env = os.Environ() // Explicitly pass environment
+// callerDeadline reports whether the request will be stopped before the
+// profile's own timeout, by a shorter timeoutSeconds or by a deadline
+// already on ctx.
+func (e *Executor) callerDeadline(ctx context.Context, profile Profile, req models.ChatRequest) bool {
+	if e.timeoutFor(profile, req) < profile.timeout {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && time.Until(deadline) < profile.timeout
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+// parse reads the output of the last attempt, tracing its tool calls.
+func (e *Executor) parse(ctx context.Context, stdout *capture) output {
+	ctx, span := tracer.Start(ctx, "claude.parse_output")
+	defer span.End()
+
+	out := parseOutput(stdout, time.Now())
+	span.SetAttributes(attribute.Int("claude.tool_calls", len(out.tools)))
+	traceTools(ctx, out.tools)
+	return out
+}
+
+// run executes claude once in dir and returns its output. attempt and
+// region describe the run for tracing.
+func (e *Executor) run(ctx context.Context, log *logrus.Entry, sessionDir string, args []string, childEnv []string, attempt int, region string) (stdout *capture, _ string, err error) {
+	var stderr bytes.Buffer
+	stdout = &capture{}
+
+	_, span := tracer.Start(ctx, "claude.subprocess", trace.WithAttributes(
+		attribute.Int("claude.attempt", attempt),
+		attribute.String("claude.region", region),
+	))
+	defer func() { tracing.End(span, err) }()
 
 	// Log the exact command for debugging
 	log.WithFields(map[string]interface{}{
@@ -315,39 +510,54 @@ func (e *Executor) Execute(prompt string, contextWindow []models.Message) (strin
 		"dir":     sessionDir,
 	}).Debug("Executing command")
 
-	// Create a context with timeout - reduced to 30 seconds since claude should respond quickly
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	// Use CommandContext for timeout support
-	cmd = exec.CommandContext(ctx, "claude", args...)
+	cmd := exec.Command("claude", args...)
 	cmd.Dir = sessionDir
-	cmd.Env = os.Environ()
-	cmd.Stdout = &stdout
+	cmd.Env = childEnv
+	cmd.Stdout = stdout
 	cmd.Stderr = &stderr
 	cmd.Stdin = nil // Explicitly set stdin to nil
+	setProcessGroup(cmd)
 
-	log.Debug("Running claude command with 30 second timeout")
+	if deadline, ok := ctx.Deadline(); ok {
+		log.WithField("timeout", time.Until(deadline).Round(time.Second).String()).Debug("Running claude command")
+	}
 
 	// Start the command
 	if err := cmd.Start(); err != nil {
 		log.WithError(err).Error("Failed to start claude command")
-		return "", nil, fmt.Errorf("failed to start claude: %w", err)
+		return stdout, "", fmt.Errorf("failed to start claude: %w", err)
 	}
+	span.SetAttributes(attribute.Int("process.pid", cmd.Process.Pid))
 
-	// Wait for completion or timeout
+	// Wait for completion, timeout or cancellation
 	done := make(chan error, 1)
 	go func() {
 		done <- cmd.Wait()
 	}()
 
-	var err error
 	select {
 	case <-ctx.Done():
-		// Timeout occurred
-		log.Error("Claude command timed out after 30 seconds")
-		if err := cmd.Process.Kill(); err != nil {
-			log.WithError(err).Warn("Failed to kill claude process")
+		// Give claude and the tools it started a chance to exit cleanly
+		// before killing the whole process group.
+		if err := terminate(cmd); err != nil {
+			log.WithError(err).Warn("Failed to terminate claude process group")
+		}
+		select {
+		case <-done:
+		case <-time.After(e.killGrace):
+			log.Warn("Claude did not exit after SIGTERM, killing process group")
+			if err := kill(cmd); err != nil {
+				log.WithError(err).Warn("Failed to kill claude process group")
+			}
+			<-done
+		}
+
+		err = ctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Error("Claude command timed out")
+			err = errTimedOut
+		} else {
+			log.Warn("Claude command cancelled")
 		}
 		// Get any partial output
 		if stderr.Len() > 0 {
@@ -356,10 +566,9 @@ func (e *Executor) Execute(prompt string, contextWindow []models.Message) (strin
 		if stdout.Len() > 0 {
 			log.WithField("stdout", stdout.String()).Error("Claude stdout before timeout")
 		}
-		return "", nil, fmt.Errorf("claude command timed out")
-	case cmdErr := <-done:
+		return stdout, stderr.String(), err
+	case err = <-done:
 		// Command completed
-		err = cmdErr
 		if err != nil {
 			log.WithError(err).Debug("Claude command completed with error")
 		}
@@ -377,36 +586,92 @@ func (e *Executor) Execute(prompt string, contextWindow []models.Message) (strin
 		if strings.Contains(outputStr, "[DEBUG]") || strings.Contains(outputStr, "[ERROR]") {
 			log.WithField("fullOutput", outputStr).Debug("Claude full output (contains debug/error)")
 		} else {
-			log.Debugf("Claude output preview: %s...", outputStr[:min(200, len(outputStr))])
+			log.WithField("outputPreview", outputStr[:min(200, len(outputStr))]).Debug("Claude output preview")
 		}
 	}
 
-	if err != nil {
-		log.WithError(err).WithField("stderr", stderr.String()).Error("Claude execution failed")
-		return "", nil, fmt.Errorf("claude execution failed: %w, stderr: %s", err, stderr.String())
+	return stdout, stderr.String(), err
+}
+
+// recordAttempt counts a finished claude process and its run time.
+func recordAttempt(outcome string, started time.Time) {
+	metrics.ExecutorAttempts.WithLabelValues(outcome).Inc()
+	metrics.SubprocessDuration.WithLabelValues(outcome).Observe(time.Since(started).Seconds())
+}
+
+// resetDir empties a session directory.
+func resetDir(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
 	}
+	return os.MkdirAll(dir, 0755)
+}
 
-	log.Debug("Scanning for output files")
-	files, err := e.scanForFiles(sessionDir)
-	if err != nil {
-		log.WithError(err).Warn("Failed to scan for files")
-		return stdout.String(), nil, err
+// CredentialStatus reports the state of the default provider's
+// credentials.
+func (e *Executor) CredentialStatus() auth.CredentialStatus {
+	return e.providers[e.profiles[""].Provider].Status()
+}
+
+// ProviderStatus reports the cached credentials of each provider, by name.
+func (e *Executor) ProviderStatus() map[string]auth.CredentialStatus {
+	status := make(map[string]auth.CredentialStatus, len(e.providers))
+	for name, provider := range e.providers {
+		status[name] = provider.Status()
 	}
+	return status
+}
 
-	log.WithField("fileCount", len(files)).Info("Claude execution completed successfully")
+// BreakerStatus reports the circuit breaker of each provider, by name.
+func (e *Executor) BreakerStatus() map[string]BreakerStatus {
+	status := make(map[string]BreakerStatus, len(e.breakers))
+	for name, breaker := range e.breakers {
+		status[name] = breaker.Status()
+	}
+	return status
+}
 
-	// Filter out debug lines from the output
-	output := stdout.String()
-	lines := strings.Split(output, "\n")
-	var filteredLines []string
-	for _, line := range lines {
-		if !strings.HasPrefix(line, "[DEBUG]") && !strings.HasPrefix(line, "[ERROR]") && strings.TrimSpace(line) != "" {
-			filteredLines = append(filteredLines, line)
-		}
+// environment builds the environment for one claude process.
+func (e *Executor) environment(ctx context.Context, provider auth.LLMProvider, profile Profile, identity *auth.Identity) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "claude.credentials", trace.WithAttributes(
+		attribute.String("claude.provider", provider.Name()),
+	))
+	env, err := provider.Environment(ctx, os.Environ(), identity)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
 	}
-	filteredOutput := strings.Join(filteredLines, "\n")
 
-	return filteredOutput, files, nil
+	return auth.ReplaceEnv(env, map[string]string{
+		"ANTHROPIC_MODEL":            profile.Model,
+		"ANTHROPIC_SMALL_FAST_MODEL": profile.SmallFastModel,
+	}), nil
+}
+
+// commandArgs builds the claude arguments for a prompt.
+func commandArgs(profile Profile, prompt string) []string {
+	args := []string{}
+	if os.Getenv("LOG_LEVEL") == "debug" {
+		args = append(args, "--debug")
+	}
+	// Streamed events time each tool call; the final result carries token
+	// usage and cost along with the text.
+	args = append(args, "--model", profile.Model, "--output-format", "stream-json", "--verbose")
+	if allowedTools := os.Getenv("CLAUDE_ALLOWED_TOOLS"); allowedTools != "" {
+		args = append(args, "--allowedTools", allowedTools)
+	}
+	// Disallowed tools with default if not set
+	disallowedTools := os.Getenv("CLAUDE_DISALLOWED_TOOLS")
+	if disallowedTools == "" {
+		disallowedTools = "Bash,Glob,Grep,LS,Read,Edit,MultiEdit,Write,NotebookRead,NotebookEdit,WebFetch,TodoRead,TodoWrite,Task"
+	}
+	args = append(args, "--disallowedTools", disallowedTools)
+	// MCP config support
+	if mcpConfig := os.Getenv("CLAUDE_MCP_CONFIG"); mcpConfig != "" {
+		logger.Log.WithField("mcp_config", mcpConfig).Debug("Adding MCP config to command")
+		args = append(args, "--mcp-config", mcpConfig)
+	}
+	return append(args, "-p", prompt)
 }
 
 func min(a, b int) int {
@@ -430,55 +695,3 @@ func (e *Executor) buildPromptWithContext(prompt string, contextWindow []models.
 	contextBuilder.WriteString(prompt)
 	return contextBuilder.String()
 }
-
-func (e *Executor) scanForFiles(dir string) ([]models.File, error) {
-	var files []models.File
-
-	entries, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		file := models.File{
-			Name:     entry.Name(),
-			Path:     filepath.Join(dir, entry.Name()),
-			Size:     info.Size(),
-			MimeType: getMimeType(entry.Name()),
-		}
-
-		files = append(files, file)
-	}
-
-	return files, nil
-}
-
-func getMimeType(filename string) string {
-	ext := strings.ToLower(filepath.Ext(filename))
-	switch ext {
-	case ".png":
-		return "image/png"
-	case ".svg":
-		return "image/svg+xml"
-	case ".jpg", ".jpeg":
-		return "image/jpeg"
-	case ".txt":
-		return "text/plain"
-	case ".json":
-		return "application/json"
-	case ".html":
-		return "text/html"
-	default:
-		return "application/octet-stream"
-	}
-}
-
@@ -0,0 +1,148 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"claude-web-go/internal/auth"
+	"claude-web-go/internal/logger"
+)
+
+const (
+	// warmUpTimeout bounds the credential fetch of each provider at startup.
+	warmUpTimeout = 10 * time.Second
+	probeTimeout  = 60 * time.Second
+	probePrompt   = "Say hello"
+)
+
+// warmUp fetches the credentials of every configured provider, so they are
+// cached and reported by readiness checks before the first request.
+// Failures are logged, not fatal: the server still starts so the problem
+// can be diagnosed through it.
+func (e *Executor) warmUp() {
+	for name, provider := range e.providers {
+		log := logger.Log.WithField("provider", name)
+
+		ctx, cancel := context.WithTimeout(context.Background(), warmUpTimeout)
+		_, err := provider.Environment(ctx, os.Environ(), nil)
+		cancel()
+		if err != nil {
+			log.WithError(err).Error("Failed to get provider credentials")
+			continue
+		}
+		log.Debug("Provider credentials fetched")
+	}
+}
+
+// ProbeResult is the outcome of a live prompt run by Probe.
+type ProbeResult struct {
+	Profile  string
+	Provider string
+	Model    string
+	Duration time.Duration
+	Output   string
+	CostUSD  float64
+	Err      *ExecutionError
+}
+
+// Probe runs a short prompt through a profile with the full tool and MCP
+// configuration, bypassing retries and the circuit breaker. It costs a
+// model call, so it only runs on demand.
+func (e *Executor) Probe(ctx context.Context, profileName string) (ProbeResult, error) {
+	profile, err := e.profile(profileName)
+	if err != nil {
+		return ProbeResult{}, err
+	}
+	target := profile.Targets[0]
+	attempt := profile.forTarget(target)
+
+	result := ProbeResult{
+		Profile:  profile.Name,
+		Provider: profile.Provider,
+		Model:    attempt.Model,
+	}
+	log := logger.FromContext(ctx).WithFields(map[string]interface{}{
+		"provider": profile.Provider,
+		"model":    attempt.Model,
+	})
+	log.Info("Probing claude")
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	env, err := e.environment(ctx, e.providers[profile.Provider], attempt, nil)
+	if err != nil {
+		result.Err = newError(ErrAuthExpired, err)
+		return result, nil
+	}
+	if target.Region != "" {
+		env = auth.ReplaceEnv(env, map[string]string{"AWS_REGION": target.Region})
+	}
+
+	// The probe gets a scratch directory so files it writes go nowhere.
+	dir, err := os.MkdirTemp(e.tmpDir, "probe-")
+	if err != nil {
+		return ProbeResult{}, fmt.Errorf("failed to create probe directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	started := time.Now()
+	stdout, stderr, err := e.run(ctx, log, dir, commandArgs(attempt, probePrompt), env, 1, target.Region)
+	result.Duration = time.Since(started)
+	if err != nil {
+		code := ErrTimeout
+		if !errors.Is(err, errTimedOut) {
+			code = classifyFailure(stderr, parseOutput(stdout, time.Now()).errorText)
+		}
+		result.Err = newError(code, err)
+		log.WithError(err).WithField("errorCode", code).Warn("Claude probe failed")
+		return result, nil
+	}
+
+	out := parseOutput(stdout, time.Now())
+	result.Output = out.text
+	if out.usage != nil {
+		out.usage.record(attempt.Model)
+		result.CostUSD = out.usage.costUSD
+	}
+	log.WithField("duration", result.Duration.Round(time.Millisecond).String()).Info("Claude probe succeeded")
+	return result, nil
+}
+
+// CheckCLI reports whether the claude CLI can be found.
+func (e *Executor) CheckCLI() error {
+	if _, err := exec.LookPath("claude"); err != nil {
+		return errors.New("claude CLI not found in PATH")
+	}
+	return nil
+}
+
+// CLIVersion returns the path and reported version of the claude CLI.
+func (e *Executor) CLIVersion(ctx context.Context) (string, string, error) {
+	path, err := exec.LookPath("claude")
+	if err != nil {
+		return "", "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, warmUpTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return path, "", fmt.Errorf("failed to get claude version: %w", err)
+	}
+	return path, strings.TrimSpace(string(output)), nil
+}
+
+// CheckWorkDir reports whether claude runs can create their directories.
+func (e *Executor) CheckWorkDir() error {
+	f, err := os.CreateTemp(e.tmpDir, ".ready-*")
+	if err != nil {
+		return fmt.Errorf("work directory is not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,204 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"claude-web-go/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// capture collects claude's stdout and when each line arrived, so tool
+// calls can be timed from the streamed events after the run. The buffer
+// isn't embedded: its ReadFrom would let io.Copy bypass Write.
+type capture struct {
+	buf      bytes.Buffer
+	arrivals []time.Time
+}
+
+func (c *capture) Write(p []byte) (int, error) {
+	now := time.Now()
+	for range bytes.Count(p, []byte("\n")) {
+		c.arrivals = append(c.arrivals, now)
+	}
+	return c.buf.Write(p)
+}
+
+func (c *capture) String() string { return c.buf.String() }
+
+func (c *capture) Len() int { return c.buf.Len() }
+
+// arrival returns when line i arrived, or fallback for a line without a
+// newline yet.
+func (c *capture) arrival(i int, fallback time.Time) time.Time {
+	if i < len(c.arrivals) {
+		return c.arrivals[i]
+	}
+	return fallback
+}
+
+// streamEvent is one line claude prints with --output-format stream-json.
+// The last line of a finished run is the result.
+type streamEvent struct {
+	Type    string `json:"type"`
+	Message *struct {
+		Content []contentBlock `json:"content"`
+	} `json:"message"`
+
+	Result  string `json:"result"`
+	IsError bool   `json:"is_error"`
+	// TotalCostUSD is named cost_usd by older CLI versions.
+	TotalCostUSD float64   `json:"total_cost_usd"`
+	CostUSD      float64   `json:"cost_usd"`
+	Usage        *cliUsage `json:"usage"`
+}
+
+// contentBlock is part of an assistant or user message: text, a tool call
+// or a tool result.
+type contentBlock struct {
+	Type      string `json:"type"`
+	Text      string `json:"text"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	ToolUseID string `json:"tool_use_id"`
+	IsError   bool   `json:"is_error"`
+}
+
+// cliUsage is the token usage of a claude run.
+type cliUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+
+	costUSD float64
+}
+
+// toolCall is a tool claude used during a run, timed by when its call and
+// result were streamed.
+type toolCall struct {
+	id       string
+	name     string
+	started  time.Time
+	finished time.Time
+	failed   bool
+}
+
+// output is what a run printed.
+type output struct {
+	text  string
+	usage *cliUsage
+	tools []toolCall
+	// errorText is the result's message when the CLI reported the run as
+	// failed.
+	errorText string
+}
+
+// parseOutput extracts the response text, usage and tool calls from
+// claude's stdout. finished is when the process exited. A run that
+// didn't get to its result, such as one that timed out, returns the text
+// streamed so far; output that isn't streamed events at all is returned
+// as text without debug lines.
+func parseOutput(stdout *capture, finished time.Time) output {
+	var out output
+	var streamed []string
+	pending := make(map[string]int)
+	events := 0
+
+	lines := strings.Split(stdout.String(), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var event streamEvent
+		if json.Unmarshal([]byte(line), &event) != nil || event.Type == "" {
+			continue
+		}
+		events++
+		at := stdout.arrival(i, finished)
+
+		switch event.Type {
+		case "result":
+			out.text = event.Result
+			if event.IsError {
+				out.errorText = event.Result
+			}
+			out.usage = event.Usage
+			if out.usage == nil {
+				out.usage = &cliUsage{}
+			}
+			out.usage.costUSD = event.TotalCostUSD
+			if out.usage.costUSD == 0 {
+				out.usage.costUSD = event.CostUSD
+			}
+		case "assistant", "user":
+			if event.Message == nil {
+				continue
+			}
+			for _, block := range event.Message.Content {
+				switch block.Type {
+				case "text":
+					streamed = append(streamed, block.Text)
+				case "tool_use":
+					pending[block.ID] = len(out.tools)
+					out.tools = append(out.tools, toolCall{id: block.ID, name: block.Name, started: at})
+				case "tool_result":
+					if j, ok := pending[block.ToolUseID]; ok {
+						out.tools[j].finished = at
+						out.tools[j].failed = block.IsError
+						delete(pending, block.ToolUseID)
+					}
+				}
+			}
+		}
+	}
+
+	// Tools still running when the process ended ran until then.
+	for _, j := range pending {
+		out.tools[j].finished = finished
+	}
+
+	switch {
+	case out.usage != nil:
+	case events > 0:
+		out.text = strings.Join(streamed, "\n\n")
+	default:
+		var filteredLines []string
+		for _, line := range lines {
+			if !strings.HasPrefix(line, "[DEBUG]") && !strings.HasPrefix(line, "[ERROR]") && strings.TrimSpace(line) != "" {
+				filteredLines = append(filteredLines, line)
+			}
+		}
+		out.text = strings.Join(filteredLines, "\n")
+	}
+	return out
+}
+
+// record counts the usage against model.
+func (u *cliUsage) record(model string) {
+	metrics.RecordUsage(model, u.InputTokens, u.OutputTokens, u.CacheReadInputTokens, u.CacheCreationInputTokens, u.costUSD)
+}
+
+// traceTools adds a span per tool call, backdated to when the call and
+// its result were streamed.
+func traceTools(ctx context.Context, tools []toolCall) {
+	for _, tool := range tools {
+		_, span := tracer.Start(ctx, "tool "+tool.name,
+			trace.WithTimestamp(tool.started),
+			trace.WithAttributes(
+				attribute.String("tool.name", tool.name),
+				attribute.String("tool.call_id", tool.id),
+			),
+		)
+		if tool.failed {
+			span.SetStatus(codes.Error, "tool returned an error")
+		}
+		span.End(trace.WithTimestamp(tool.finished))
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package claude
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// terminate interrupts cmd; child processes are left to exit with it.
+func terminate(cmd *exec.Cmd) error {
+	return cmd.Process.Signal(os.Interrupt)
+}
+
+func kill(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
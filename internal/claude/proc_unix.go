@@ -0,0 +1,24 @@
+//go:build unix
+
+package claude
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts cmd in its own process group, so the node
+// processes and MCP servers it spawns can be stopped with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminate asks cmd's process group to exit.
+func terminate(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// kill stops cmd's process group immediately.
+func kill(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
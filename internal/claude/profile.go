@@ -0,0 +1,171 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"claude-web-go/internal/auth"
+)
+
+// Profile is a named set of execution settings a request can select. The
+// default profile, named "", comes from LLM_PROVIDER, ANTHROPIC_MODEL and
+// ANTHROPIC_SMALL_FAST_MODEL.
+type Profile struct {
+	Name           string `json:"-"`
+	Provider       string `json:"provider"`
+	Model          string `json:"model"`
+	SmallFastModel string `json:"smallFastModel"`
+	// Regions lists Bedrock regions to fail over between, in order. An
+	// entry may name the inference profile to use there as
+	// "region=modelID".
+	Regions []string `json:"regions"`
+	// Timeout overrides CLAUDE_TIMEOUT, as a Go duration such as "10m".
+	Timeout string `json:"timeout"`
+
+	// Targets are the parsed Regions; providers without regions have a
+	// single empty target.
+	Targets []RegionTarget `json:"-"`
+	// region is the target region of a single attempt.
+	region string
+	// timeout is the parsed Timeout.
+	timeout time.Duration
+}
+
+// RegionTarget is one place a request can be sent.
+type RegionTarget struct {
+	Region string
+	// Model overrides the profile's model, for region-specific inference
+	// profiles.
+	Model string
+}
+
+// forTarget returns the profile as used for one attempt.
+func (p Profile) forTarget(target RegionTarget) Profile {
+	if target.Model != "" {
+		p.Model = target.Model
+	}
+	p.region = target.Region
+	return p
+}
+
+// parseRegionTargets parses region entries of the form "region" or
+// "region=modelID".
+func parseRegionTargets(entries []string) ([]RegionTarget, error) {
+	var targets []RegionTarget
+	for _, entry := range entries {
+		region, model, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if region == "" {
+			continue
+		}
+		if strings.ContainsAny(region, " /") {
+			return nil, fmt.Errorf("invalid region %q", region)
+		}
+		targets = append(targets, RegionTarget{Region: region, Model: strings.TrimSpace(model)})
+	}
+	return targets, nil
+}
+
+// resolveTargets fills in p.Targets for its provider.
+func (p *Profile) resolveTargets() error {
+	if p.Provider != auth.ProviderBedrock {
+		p.Targets = []RegionTarget{{}}
+		return nil
+	}
+
+	targets, err := parseRegionTargets(p.Regions)
+	if err != nil {
+		return fmt.Errorf("profile %q: %w", p.Name, err)
+	}
+	if len(targets) == 0 {
+		targets = []RegionTarget{{Region: auth.Region()}}
+	}
+	p.Targets = targets
+	return nil
+}
+
+// LoadProfiles returns the default profile plus those defined in the JSON
+// file named by CLAUDE_PROFILES_FILE, keyed by name. Profiles that leave
+// out the provider use the default one, and profiles on the default
+// provider inherit the default models and BEDROCK_REGIONS.
+func LoadProfiles() (map[string]Profile, error) {
+	base := Profile{
+		Provider:       auth.DefaultProviderName(),
+		Model:          os.Getenv("ANTHROPIC_MODEL"),
+		SmallFastModel: os.Getenv("ANTHROPIC_SMALL_FAST_MODEL"),
+	}
+	if regions := os.Getenv("BEDROCK_REGIONS"); regions != "" {
+		base.Regions = strings.Split(regions, ",")
+	}
+	profiles := map[string]Profile{"": base}
+
+	path := os.Getenv("CLAUDE_PROFILES_FILE")
+	if path == "" {
+		return profiles, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+
+	var defined map[string]Profile
+	if err := json.Unmarshal(data, &defined); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles %s: %w", path, err)
+	}
+
+	for name, profile := range defined {
+		if name == "" {
+			return nil, fmt.Errorf("profile names must not be empty")
+		}
+		profile.Name = name
+		if profile.Timeout != "" {
+			timeout, err := time.ParseDuration(profile.Timeout)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("profile %q: invalid timeout %q", name, profile.Timeout)
+			}
+			profile.timeout = timeout
+		}
+		if profile.Provider == "" {
+			profile.Provider = base.Provider
+		}
+		if profile.Provider == base.Provider {
+			if profile.Model == "" {
+				profile.Model = base.Model
+			}
+			if profile.SmallFastModel == "" {
+				profile.SmallFastModel = base.SmallFastModel
+			}
+			if len(profile.Regions) == 0 {
+				profile.Regions = base.Regions
+			}
+		}
+		profiles[name] = profile
+	}
+
+	return profiles, nil
+}
+
+// profileNames returns the names of profiles, sorted, for logging.
+func profileNames(profiles map[string]Profile) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profile returns the named profile; "" is the default.
+func (e *Executor) profile(name string) (Profile, error) {
+	profile, ok := e.profiles[name]
+	if !ok {
+		return Profile{}, invalidRequest("unknown profile %q", name)
+	}
+	return profile, nil
+}
@@ -0,0 +1,55 @@
+package claude
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"claude-web-go/internal/config"
+)
+
+// RetryPolicy bounds how a request is retried after transient failures.
+type RetryPolicy struct {
+	// MaxAttempts is the most claude runs per request, retries included.
+	MaxAttempts int
+	// BaseDelay is the backoff cap before the first retry; it doubles for
+	// each further retry up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Budget is the most time a request may spend before starting another
+	// attempt.
+	Budget time.Duration
+}
+
+// RetryPolicyFromEnv reads the policy from CLAUDE_MAX_ATTEMPTS,
+// CLAUDE_RETRY_BASE_DELAY, CLAUDE_RETRY_MAX_DELAY and CLAUDE_RETRY_BUDGET.
+func RetryPolicyFromEnv() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: config.Int("CLAUDE_MAX_ATTEMPTS", 3),
+		BaseDelay:   config.Duration("CLAUDE_RETRY_BASE_DELAY", time.Second),
+		MaxDelay:    config.Duration("CLAUDE_RETRY_MAX_DELAY", 8*time.Second),
+		Budget:      config.Duration("CLAUDE_RETRY_BUDGET", 2*time.Minute),
+	}
+}
+
+// delay returns the wait before the given retry (1 for the first), with
+// full jitter so concurrent requests don't retry in lockstep.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	ceiling := p.MaxDelay
+	if shift := retry - 1; shift < 30 && p.BaseDelay<<shift < ceiling {
+		ceiling = p.BaseDelay << shift
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling) + 1
+}
+
+// retryable reports whether a failure is worth running again: provider
+// throttling and capacity errors, and unexplained CLI failures.
+func retryable(code ErrorCode) bool {
+	switch code {
+	case ErrThrottled, ErrUnavailable, ErrInternal:
+		return true
+	}
+	return false
+}
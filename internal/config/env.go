@@ -0,0 +1,40 @@
+// Package config reads numeric and duration settings from the environment.
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"claude-web-go/internal/logger"
+)
+
+// Int returns the positive integer in the environment variable key, or
+// fallback when it is unset or invalid.
+func Int(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		logger.Log.WithField("key", key).WithField("value", value).Warn("Ignoring invalid numeric setting")
+		return fallback
+	}
+	return n
+}
+
+// Duration returns the non-negative duration in the environment variable
+// key, or fallback when it is unset or invalid.
+func Duration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		logger.Log.WithField("key", key).WithField("value", value).Warn("Ignoring invalid duration setting")
+		return fallback
+	}
+	return d
+}
@@ -0,0 +1,270 @@
+package filetype
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// SniffLen is how many leading bytes are inspected for magic numbers and
+// text/binary detection.
+const SniffLen = 512
+
+// Info describes how a generated file should be served and previewed.
+type Info struct {
+	MimeType    string
+	Text        bool
+	Previewable bool
+	// Language is a syntax highlighting hint for code and markup files,
+	// using Prism's language identifiers.
+	Language string
+}
+
+const defaultMimeType = "application/octet-stream"
+
+var registry = map[string]Info{
+	// Images
+	".png":  {MimeType: "image/png", Previewable: true},
+	".jpg":  {MimeType: "image/jpeg", Previewable: true},
+	".jpeg": {MimeType: "image/jpeg", Previewable: true},
+	".gif":  {MimeType: "image/gif", Previewable: true},
+	".webp": {MimeType: "image/webp", Previewable: true},
+	".svg":  {MimeType: "image/svg+xml", Text: true, Previewable: true, Language: "markup"},
+
+	// Documents
+	".pdf":      {MimeType: "application/pdf", Previewable: true},
+	".txt":      {MimeType: "text/plain", Text: true, Previewable: true},
+	".log":      {MimeType: "text/plain", Text: true, Previewable: true},
+	".md":       {MimeType: "text/markdown", Text: true, Previewable: true, Language: "markdown"},
+	".markdown": {MimeType: "text/markdown", Text: true, Previewable: true, Language: "markdown"},
+	".csv":      {MimeType: "text/csv", Text: true, Previewable: true, Language: "csv"},
+	".tsv":      {MimeType: "text/tab-separated-values", Text: true, Previewable: true},
+	".html":     {MimeType: "text/html", Text: true, Previewable: true, Language: "markup"},
+	".htm":      {MimeType: "text/html", Text: true, Previewable: true, Language: "markup"},
+	".xml":      {MimeType: "application/xml", Text: true, Previewable: true, Language: "markup"},
+	".json":     {MimeType: "application/json", Text: true, Previewable: true, Language: "json"},
+	".yaml":     {MimeType: "application/yaml", Text: true, Previewable: true, Language: "yaml"},
+	".yml":      {MimeType: "application/yaml", Text: true, Previewable: true, Language: "yaml"},
+	".toml":     {MimeType: "application/toml", Text: true, Previewable: true, Language: "toml"},
+
+	// Diagram sources
+	".puml":     {MimeType: "text/x-plantuml", Text: true, Previewable: true, Language: "plantuml"},
+	".plantuml": {MimeType: "text/x-plantuml", Text: true, Previewable: true, Language: "plantuml"},
+	".dot":      {MimeType: "text/vnd.graphviz", Text: true, Previewable: true, Language: "dot"},
+	".gv":       {MimeType: "text/vnd.graphviz", Text: true, Previewable: true, Language: "dot"},
+	".mmd":      {MimeType: "text/x-mermaid", Text: true, Previewable: true, Language: "mermaid"},
+
+	// Code
+	".py":   {MimeType: "text/x-python", Text: true, Previewable: true, Language: "python"},
+	".go":   {MimeType: "text/x-go", Text: true, Previewable: true, Language: "go"},
+	".js":   {MimeType: "text/javascript", Text: true, Previewable: true, Language: "javascript"},
+	".mjs":  {MimeType: "text/javascript", Text: true, Previewable: true, Language: "javascript"},
+	".ts":   {MimeType: "text/x-typescript", Text: true, Previewable: true, Language: "typescript"},
+	".rs":   {MimeType: "text/x-rust", Text: true, Previewable: true, Language: "rust"},
+	".java": {MimeType: "text/x-java", Text: true, Previewable: true, Language: "java"},
+	".c":    {MimeType: "text/x-c", Text: true, Previewable: true, Language: "c"},
+	".h":    {MimeType: "text/x-c", Text: true, Previewable: true, Language: "c"},
+	".cpp":  {MimeType: "text/x-c++", Text: true, Previewable: true, Language: "cpp"},
+	".rb":   {MimeType: "text/x-ruby", Text: true, Previewable: true, Language: "ruby"},
+	".sh":   {MimeType: "text/x-shellscript", Text: true, Previewable: true, Language: "bash"},
+	".sql":  {MimeType: "application/sql", Text: true, Previewable: true, Language: "sql"},
+	".css":  {MimeType: "text/css", Text: true, Previewable: true, Language: "css"},
+
+	// Archives
+	".zip": {MimeType: "application/zip"},
+	".gz":  {MimeType: "application/gzip"},
+	".tar": {MimeType: "application/x-tar"},
+}
+
+type signature struct {
+	offset int
+	magic  []byte
+	info   Info
+}
+
+var signatures = []signature{
+	{0, []byte("\x89PNG\r\n\x1a\n"), registry[".png"]},
+	{0, []byte("\xff\xd8\xff"), registry[".jpg"]},
+	{0, []byte("GIF87a"), registry[".gif"]},
+	{0, []byte("GIF89a"), registry[".gif"]},
+	{8, []byte("WEBP"), registry[".webp"]},
+	{0, []byte("%PDF-"), registry[".pdf"]},
+	{0, []byte("PK\x03\x04"), registry[".zip"]},
+	{0, []byte("\x1f\x8b"), registry[".gz"]},
+}
+
+var interpreters = map[string]string{
+	"python":  ".py",
+	"python3": ".py",
+	"node":    ".js",
+	"bash":    ".sh",
+	"sh":      ".sh",
+	"ruby":    ".rb",
+}
+
+// Detect identifies a file from its name and leading bytes. Binary
+// extensions are trusted as-is. Magic numbers override text extensions, so
+// a PNG saved as "diagram.txt" is still reported as an image, and unknown
+// extensions fall back to magic numbers and text/binary detection.
+func Detect(name string, head []byte) Info {
+	ext := strings.ToLower(filepath.Ext(name))
+	info, known := registry[ext]
+	if known && !info.Text {
+		return info
+	}
+
+	if magic, ok := sniffMagic(head); ok {
+		return magic
+	}
+
+	if known {
+		if len(head) > 0 && !IsText(head) {
+			return Info{MimeType: defaultMimeType}
+		}
+		if info.MimeType == "application/xml" {
+			return detectXML(head, info)
+		}
+		return info
+	}
+
+	if len(head) == 0 || !IsText(head) {
+		return Info{MimeType: defaultMimeType}
+	}
+
+	if isSVG(head) {
+		return registry[".svg"]
+	}
+	if ext := shebangExtension(head); ext != "" {
+		return registry[ext]
+	}
+	return registry[".txt"]
+}
+
+// DetectFile reads the start of the file at path and calls Detect.
+func DetectFile(path string) (Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+
+	head := make([]byte, SniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return Info{}, err
+	}
+
+	return Detect(path, head[:n]), nil
+}
+
+// ByExtension looks a file up in the registry without inspecting content.
+func ByExtension(name string) Info {
+	if info, ok := registry[strings.ToLower(filepath.Ext(name))]; ok {
+		return info
+	}
+	return Info{MimeType: defaultMimeType}
+}
+
+// IsText reports whether data looks like UTF-8 text. A multi-byte rune cut
+// off at the end of the sample is tolerated.
+func IsText(data []byte) bool {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return false
+	}
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			return len(data) < utf8.UTFMax && !utf8.FullRune(data)
+		}
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' && r != '\f' && r != 0x1b {
+			return false
+		}
+		data = data[size:]
+	}
+	return true
+}
+
+func sniffMagic(head []byte) (Info, bool) {
+	for _, sig := range signatures {
+		end := sig.offset + len(sig.magic)
+		if len(head) >= end && bytes.Equal(head[sig.offset:end], sig.magic) {
+			return sig.info, true
+		}
+	}
+	return Info{}, false
+}
+
+func isSVG(head []byte) bool {
+	trimmed := bytes.TrimSpace(head)
+	if bytes.HasPrefix(trimmed, []byte("<svg")) {
+		return true
+	}
+	return bytes.HasPrefix(trimmed, []byte("<?xml")) && bytes.Contains(trimmed, []byte("<svg"))
+}
+
+// XML namespaces whose elements browsers render as active content.
+const (
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	xhtmlNamespace = "http://www.w3.org/1999/xhtml"
+)
+
+// detectXML checks an XML document for content a browser would render as
+// SVG or HTML. A document whose root is SVG is treated as an SVG file, so it
+// is sanitized when stored. Documents that use the XHTML namespace, or SVG
+// below another root, or that apply an XSLT stylesheet, are served as
+// downloads.
+func detectXML(head []byte, info Info) Info {
+	decoder := xml.NewDecoder(bytes.NewReader(head))
+	decoder.Strict = false
+	root := true
+	for {
+		token, err := decoder.RawToken()
+		if err != nil {
+			// The rest of the document was cut off by the sample.
+			return info
+		}
+		switch t := token.(type) {
+		case xml.ProcInst:
+			if t.Target == "xml-stylesheet" {
+				return Info{MimeType: defaultMimeType}
+			}
+		case xml.StartElement:
+			for _, attr := range t.Attr {
+				declaration := attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns")
+				if !declaration || (attr.Value != svgNamespace && attr.Value != xhtmlNamespace) {
+					continue
+				}
+				// Only a plain <svg xmlns="..."> root is left to the SVG
+				// sanitizer.
+				if root && attr.Value == svgNamespace && t.Name.Space == "" && t.Name.Local == "svg" && attr.Name.Space == "" {
+					return registry[".svg"]
+				}
+				return Info{MimeType: defaultMimeType}
+			}
+			root = false
+		}
+	}
+}
+
+func shebangExtension(head []byte) string {
+	if !bytes.HasPrefix(head, []byte("#!")) {
+		return ""
+	}
+	line := string(head[2:])
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" && len(fields) > 1 {
+		interpreter = fields[1]
+	}
+	return interpreters[interpreter]
+}
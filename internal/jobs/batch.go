@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"claude-web-go/internal/auth"
+	"claude-web-go/internal/logger"
+	"claude-web-go/internal/models"
+	"github.com/google/uuid"
+)
+
+// MaxBatchItems bounds the number of items in one batch. It stays within
+// the default readiness limit on queued jobs, READY_MAX_QUEUED_JOBS.
+const MaxBatchItems = 100
+
+// ErrInvalidBatch wraps the reasons a batch request is rejected.
+var ErrInvalidBatch = errors.New("invalid batch")
+
+// placeholder matches {{name}} in batch templates.
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// batch is a submitted batch. Batches are kept in memory only; their items
+// are ordinary jobs and stay in the job table.
+type batch struct {
+	id        string
+	template  string
+	profile   string
+	owner     string
+	createdAt time.Time
+	items     []models.BatchItem
+}
+
+// SubmitBatch renders the template for every item and queues each prompt
+// as a background job in its own session.
+func (m *Manager) SubmitBatch(ctx context.Context, req models.BatchRequest) (models.Batch, error) {
+	prompts, err := render(req)
+	if err != nil {
+		return models.Batch{}, err
+	}
+
+	b := &batch{
+		id:        uuid.New().String(),
+		template:  req.Template,
+		profile:   req.Profile,
+		owner:     auth.UserFromContext(ctx),
+		createdAt: time.Now(),
+	}
+	for i, prompt := range prompts {
+		job, err := m.SubmitBackground(ctx, models.ChatRequest{
+			Message:        prompt,
+			SessionID:      uuid.New().String(),
+			Profile:        req.Profile,
+			TimeoutSeconds: req.TimeoutSeconds,
+		}, nil)
+		if err != nil {
+			for _, item := range b.items {
+				m.Cancel(ctx, item.JobID)
+			}
+			return models.Batch{}, err
+		}
+		b.items = append(b.items, models.BatchItem{
+			Index:     i + 1,
+			Variables: req.Items[i],
+			JobID:     job.ID,
+			SessionID: job.SessionID,
+		})
+	}
+
+	m.mu.Lock()
+	m.batches[b.id] = b
+	view := m.batchView(b)
+	m.mu.Unlock()
+
+	logger.FromContext(ctx).WithFields(map[string]interface{}{
+		"batchID": b.id,
+		"items":   len(b.items),
+	}).Info("Batch queued")
+	return view, nil
+}
+
+// Batch returns the batch with its items' current status if the caller may
+// see it.
+func (m *Manager) Batch(ctx context.Context, id string) (models.Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.batches[id]
+	if !ok || b.owner != auth.UserFromContext(ctx) {
+		return models.Batch{}, ErrNotFound
+	}
+	return m.batchView(b), nil
+}
+
+// CancelBatch cancels every item that hasn't finished.
+func (m *Manager) CancelBatch(ctx context.Context, id string) (models.Batch, error) {
+	b, err := m.Batch(ctx, id)
+	if err != nil {
+		return models.Batch{}, err
+	}
+	for _, item := range b.Items {
+		if _, err := m.Cancel(ctx, item.JobID); err != nil && !errors.Is(err, ErrFinished) && !errors.Is(err, ErrNotFound) {
+			return models.Batch{}, err
+		}
+	}
+	logger.FromContext(ctx).WithField("batchID", id).Info("Batch cancellation requested")
+	return m.Batch(ctx, id)
+}
+
+// batchView fills in the items' status from their jobs. Items whose jobs
+// have expired are reported as failed. Callers must hold m.mu.
+func (m *Manager) batchView(b *batch) models.Batch {
+	view := models.Batch{
+		ID:        b.id,
+		Template:  b.template,
+		Profile:   b.profile,
+		Status:    models.BatchFinished,
+		Counts:    make(map[string]int),
+		Items:     make([]models.BatchItem, len(b.items)),
+		CreatedAt: b.createdAt,
+	}
+	for i, item := range b.items {
+		if r, ok := m.jobs[item.JobID]; ok {
+			item.Status = r.Status
+			item.Error = r.Error
+			item.ErrorCode = r.ErrorCode
+			if !r.finished() {
+				view.Status = models.BatchRunning
+			}
+		} else {
+			item.Status = models.JobFailed
+			item.Error = "The job has expired."
+		}
+		view.Counts[item.Status]++
+		view.Items[i] = item
+	}
+	return view
+}
+
+// render returns the prompt of every item, checking that each item defines
+// every variable the template uses.
+func render(req models.BatchRequest) ([]string, error) {
+	if strings.TrimSpace(req.Template) == "" {
+		return nil, fmt.Errorf("%w: template is empty", ErrInvalidBatch)
+	}
+	if len(req.Items) == 0 {
+		return nil, fmt.Errorf("%w: no items", ErrInvalidBatch)
+	}
+	if len(req.Items) > MaxBatchItems {
+		return nil, fmt.Errorf("%w: %d items, at most %d are allowed", ErrInvalidBatch, len(req.Items), MaxBatchItems)
+	}
+
+	prompts := make([]string, len(req.Items))
+	for i, vars := range req.Items {
+		prompt, err := RenderTemplate(req.Template, vars)
+		if err != nil {
+			return nil, fmt.Errorf("%w: item %d: %v", ErrInvalidBatch, i+1, err)
+		}
+		prompts[i] = prompt
+	}
+	return prompts, nil
+}
+
+// RenderTemplate replaces every {{name}} in template with the variable's
+// value. Every variable the template uses must be defined.
+func RenderTemplate(template string, vars map[string]string) (string, error) {
+	var missing string
+	rendered := placeholder.ReplaceAllStringFunc(template, func(match string) string {
+		name := placeholder.FindStringSubmatch(match)[1]
+		value, ok := vars[name]
+		if !ok && missing == "" {
+			missing = name
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("undefined variable %q", missing)
+	}
+	return rendered, nil
+}
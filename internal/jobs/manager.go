@@ -0,0 +1,492 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"claude-web-go/internal/auth"
+	"claude-web-go/internal/config"
+	"claude-web-go/internal/logger"
+	"claude-web-go/internal/metrics"
+	"claude-web-go/internal/models"
+	"claude-web-go/internal/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultDir         = "/tmp/claude-web-jobs"
+	defaultConcurrency = 4
+	defaultRetention   = 24 * time.Hour
+)
+
+// ErrInterrupted is the error code of jobs that were queued or running when
+// the server stopped, or still running at the shutdown deadline. They are
+// not resumed.
+const ErrInterrupted = "interrupted"
+
+var tracer = tracing.Tracer("jobs")
+
+var (
+	ErrNotFound = errors.New("job not found")
+	ErrFinished = errors.New("job already finished")
+	// ErrShuttingDown is returned for jobs submitted after Shutdown.
+	ErrShuttingDown = errors.New("the server is shutting down")
+)
+
+// Runner executes a chat request and builds its response.
+type Runner func(ctx context.Context, req models.ChatRequest) models.ChatResponse
+
+// Notifier is told about every job that finishes, with the job's own
+// webhook if it has one.
+type Notifier func(owner string, job models.Job, webhook *models.Webhook)
+
+// Manager runs chat requests in the background, in submission order and at
+// most JOBS_CONCURRENCY at a time, and keeps a job table in JOBS_DIR so
+// finished jobs can still be fetched after a restart.
+type Manager struct {
+	run       Runner
+	notify    Notifier
+	store     *store
+	retention time.Duration
+
+	mu      sync.Mutex
+	ready   *sync.Cond
+	queue   []pending
+	jobs    map[string]*record
+	cancels map[string]context.CancelFunc
+	batches map[string]*batch
+	// stopping is set by Shutdown; workers then exit instead of starting
+	// queued jobs.
+	stopping bool
+	workers  sync.WaitGroup
+}
+
+// pending is a queued job waiting for a worker. wait spans the time in the
+// queue. background jobs were created by the server itself, for a batch
+// item or a schedule run.
+type pending struct {
+	id         string
+	ctx        context.Context
+	req        models.ChatRequest
+	wait       trace.Span
+	background bool
+}
+
+func NewManager(run Runner, notify Notifier) (*Manager, error) {
+	dir := os.Getenv("JOBS_DIR")
+	if dir == "" {
+		dir = defaultDir
+	}
+	store, err := newStore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		run:       run,
+		notify:    notify,
+		store:     store,
+		retention: config.Duration("JOBS_RETENTION", defaultRetention),
+		jobs:      make(map[string]*record),
+		cancels:   make(map[string]context.CancelFunc),
+		batches:   make(map[string]*batch),
+	}
+	m.ready = sync.NewCond(&m.mu)
+	m.recover()
+
+	for i := 0; i < config.Int("JOBS_CONCURRENCY", defaultConcurrency); i++ {
+		m.workers.Add(1)
+		go m.worker()
+	}
+	go m.cleanup()
+	return m, nil
+}
+
+// recover loads the job table, failing the jobs the previous process left
+// queued or running.
+func (m *Manager) recover() {
+	records, errs := m.store.load()
+	for _, err := range errs {
+		logger.Log.WithError(err).Warn("Skipping unreadable job record")
+	}
+
+	interrupted := 0
+	now := time.Now()
+	for _, r := range records {
+		if !r.finished() {
+			r.Status = models.JobFailed
+			r.Error = "The server restarted before the job finished."
+			r.ErrorCode = ErrInterrupted
+			r.FinishedAt = &now
+			if err := m.store.save(r); err != nil {
+				logger.Log.WithError(err).WithField("jobID", r.ID).Warn("Failed to save interrupted job")
+			}
+			interrupted++
+			m.notify(r.Owner, r.Job, r.Webhook)
+		}
+		m.jobs[r.ID] = r
+	}
+
+	logger.Log.WithFields(map[string]interface{}{
+		"dir":         m.store.dir,
+		"jobs":        len(records),
+		"interrupted": interrupted,
+	}).Info("Loaded job table")
+}
+
+// Submit queues req and returns the new job. The job runs with the
+// caller's identity but not its context, so it outlives the request.
+// webhook, if not nil, is notified when the job finishes.
+func (m *Manager) Submit(ctx context.Context, req models.ChatRequest, webhook *models.Webhook) (models.Job, error) {
+	return m.submit(ctx, req, webhook, false)
+}
+
+// SubmitBackground queues a job the server creates on its own, such as a
+// schedule run. Stats counts it apart from submitted jobs.
+func (m *Manager) SubmitBackground(ctx context.Context, req models.ChatRequest, webhook *models.Webhook) (models.Job, error) {
+	return m.submit(ctx, req, webhook, true)
+}
+
+func (m *Manager) submit(ctx context.Context, req models.ChatRequest, webhook *models.Webhook, background bool) (models.Job, error) {
+	identity := auth.IdentityFromContext(ctx)
+	r := &record{
+		Job: models.Job{
+			ID:        uuid.New().String(),
+			SessionID: req.SessionID,
+			Profile:   req.Profile,
+			Status:    models.JobQueued,
+			CreatedAt: time.Now(),
+		},
+		Owner:   auth.UserFromContext(ctx),
+		Webhook: webhook,
+	}
+	if webhook != nil {
+		r.WebhookID = webhook.ID
+	}
+
+	// The job continues the submitter's trace, if any.
+	runCtx := trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+	if identity != nil {
+		runCtx = auth.WithIdentity(runCtx, identity)
+	}
+	// It also keeps logging with the submitting request's fields.
+	log := logger.FromContext(ctx).WithField("jobID", r.ID)
+	runCtx = logger.WithContext(runCtx, log)
+	runCtx, cancel := context.WithCancel(runCtx)
+	_, wait := tracer.Start(runCtx, "job.queued", trace.WithAttributes(
+		attribute.String("job.id", r.ID),
+	))
+
+	m.mu.Lock()
+	if m.stopping {
+		m.mu.Unlock()
+		cancel()
+		tracing.End(wait, ErrShuttingDown)
+		return models.Job{}, ErrShuttingDown
+	}
+	if err := m.store.save(r); err != nil {
+		m.mu.Unlock()
+		cancel()
+		tracing.End(wait, err)
+		return models.Job{}, fmt.Errorf("failed to save job: %w", err)
+	}
+	m.jobs[r.ID] = r
+	m.cancels[r.ID] = cancel
+	m.queue = append(m.queue, pending{id: r.ID, ctx: runCtx, req: req, wait: wait, background: background})
+	metrics.JobsQueued.Set(float64(len(m.queue)))
+	m.ready.Signal()
+	job := r.Job
+	m.mu.Unlock()
+
+	log.WithField("sessionID", job.SessionID).Info("Job queued")
+
+	return job, nil
+}
+
+// Get returns the job with the given ID if the caller may see it.
+func (m *Manager) Get(ctx context.Context, id string) (models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.visible(ctx, id)
+	if !ok {
+		return models.Job{}, ErrNotFound
+	}
+	return r.Job, nil
+}
+
+// List returns the caller's jobs in a session, oldest first.
+func (m *Manager) List(ctx context.Context, sessionID string) []models.Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	caller := auth.UserFromContext(ctx)
+	jobs := []models.Job{}
+	for _, r := range m.jobs {
+		if r.SessionID == sessionID && r.Owner == caller {
+			jobs = append(jobs, r.Job)
+		}
+	}
+	slices.SortFunc(jobs, func(a, b models.Job) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return jobs
+}
+
+// Cancel stops a queued or running job. A queued job is cancelled at once;
+// a running one reaches the cancelled status once its run has stopped.
+func (m *Manager) Cancel(ctx context.Context, id string) (models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.visible(ctx, id)
+	if !ok {
+		return models.Job{}, ErrNotFound
+	}
+	if r.finished() {
+		return r.Job, ErrFinished
+	}
+	m.cancels[id]()
+	if r.Status == models.JobQueued {
+		for i, p := range m.queue {
+			if p.id == id {
+				p.wait.End()
+				m.queue = append(m.queue[:i], m.queue[i+1:]...)
+				metrics.JobsQueued.Set(float64(len(m.queue)))
+				break
+			}
+		}
+		now := time.Now()
+		m.apply(r, func(r *record) {
+			r.Status = models.JobCancelled
+			r.FinishedAt = &now
+		})
+	}
+	logger.FromContext(ctx).WithField("jobID", id).Info("Job cancellation requested")
+	return r.Job, nil
+}
+
+// Retention is how long finished jobs are kept; zero keeps them forever.
+func (m *Manager) Retention() time.Duration {
+	return m.retention
+}
+
+// Stats returns the number of submitted and background jobs waiting for a
+// worker, and the number running.
+func (m *Manager) Stats() (queued, background, running int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.queue {
+		if p.background {
+			background++
+		} else {
+			queued++
+		}
+	}
+	for _, r := range m.jobs {
+		if r.Status == models.JobRunning {
+			running++
+		}
+	}
+	return queued, background, running
+}
+
+// Shutdown stops starting queued jobs and waits for the running ones to
+// finish. When ctx is done first, the running jobs are cancelled and
+// Shutdown waits for their outcome to be saved. Jobs still queued stay in
+// the job table and are reported as interrupted after the next start.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.stopping = true
+	m.ready.Broadcast()
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	cancelled := 0
+	m.mu.Lock()
+	for id, r := range m.jobs {
+		if r.Status == models.JobRunning {
+			logger.Log.WithField("jobID", id).Warn("Cancelling job still running at shutdown")
+			m.cancels[id]()
+			cancelled++
+		}
+	}
+	m.mu.Unlock()
+	<-done
+	if cancelled == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d running jobs cancelled: %w", cancelled, ctx.Err())
+}
+
+// CheckWritable reports whether the job table can be written.
+func (m *Manager) CheckWritable() error {
+	return m.store.check()
+}
+
+// visible returns the job if it belongs to the caller. Jobs of other users
+// are reported as missing. Callers must hold m.mu.
+func (m *Manager) visible(ctx context.Context, id string) (*record, bool) {
+	r, ok := m.jobs[id]
+	if !ok || r.Owner != auth.UserFromContext(ctx) {
+		return nil, false
+	}
+	return r, true
+}
+
+// worker runs queued jobs one at a time, oldest first. A job leaves the
+// queue and becomes running under the same lock, so Cancel sees it in
+// exactly one of the two states.
+func (m *Manager) worker() {
+	defer m.workers.Done()
+	for {
+		m.mu.Lock()
+		for len(m.queue) == 0 && !m.stopping {
+			m.ready.Wait()
+		}
+		if m.stopping {
+			m.mu.Unlock()
+			return
+		}
+		next := m.queue[0]
+		next.wait.End()
+		m.queue = m.queue[1:]
+		metrics.JobsQueued.Set(float64(len(m.queue)))
+		started := time.Now()
+		if r, ok := m.jobs[next.id]; ok {
+			m.apply(r, func(r *record) {
+				r.Status = models.JobRunning
+				r.StartedAt = &started
+			})
+		}
+		m.mu.Unlock()
+
+		m.process(next.ctx, next.id, next.req, started)
+	}
+}
+
+func (m *Manager) process(ctx context.Context, id string, req models.ChatRequest, started time.Time) {
+	log := logger.FromContext(ctx).WithField("jobID", id)
+	log.Info("Job started")
+
+	ctx, span := tracer.Start(ctx, "job.run", trace.WithAttributes(
+		attribute.String("job.id", id),
+	))
+	defer span.End()
+
+	response := m.run(ctx, req)
+
+	finished := time.Now()
+	m.update(id, func(r *record) {
+		r.Response = &response
+		r.Error = response.Error
+		r.ErrorCode = response.ErrorCode
+		r.FinishedAt = &finished
+
+		usage := &models.JobUsage{DurationMs: finished.Sub(started).Milliseconds()}
+		if response.Metadata != nil {
+			usage.Attempts = response.Metadata.Attempts
+			if tokens := response.Metadata.Usage; tokens != nil {
+				usage.InputTokens = tokens.InputTokens
+				usage.OutputTokens = tokens.OutputTokens
+				usage.CostUSD = tokens.CostUSD
+			}
+		}
+		r.Usage = usage
+
+		switch {
+		case response.ErrorCode == "":
+			r.Status = models.JobCompleted
+		case ctx.Err() != nil && m.stopping:
+			r.Status = models.JobFailed
+			r.Error = "The server shut down before the job finished."
+			r.ErrorCode = ErrInterrupted
+		case ctx.Err() != nil:
+			r.Status = models.JobCancelled
+		default:
+			r.Status = models.JobFailed
+		}
+	})
+	log.WithField("errorCode", response.ErrorCode).Info("Job finished")
+}
+
+// update applies fn to the job and saves it.
+func (m *Manager) update(id string, fn func(r *record)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.jobs[id]; ok {
+		m.apply(r, fn)
+	}
+}
+
+// apply changes r with fn and saves it. Once the job has finished, its
+// cancel function is released and the notifier is called. Callers must
+// hold m.mu.
+func (m *Manager) apply(r *record, fn func(r *record)) {
+	fn(r)
+	if err := m.store.save(r); err != nil {
+		logger.Log.WithError(err).WithField("jobID", r.ID).Error("Failed to save job")
+	}
+	if r.finished() {
+		if cancel, ok := m.cancels[r.ID]; ok {
+			cancel()
+			delete(m.cancels, r.ID)
+			m.notify(r.Owner, r.Job, r.Webhook)
+		}
+	}
+}
+
+// cleanup removes finished jobs older than the retention period, and the
+// batches they belonged to. A zero retention keeps them forever.
+func (m *Manager) cleanup() {
+	if m.retention == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.mu.Lock()
+		now := time.Now()
+
+		for id, r := range m.jobs {
+			if r.finished() && r.FinishedAt != nil && now.Sub(*r.FinishedAt) > m.retention {
+				if err := m.store.remove(id); err != nil {
+					logger.Log.WithError(err).WithField("jobID", id).Warn("Failed to remove expired job")
+					continue
+				}
+				delete(m.jobs, id)
+			}
+		}
+		// A batch goes once none of its jobs is left.
+		for id, b := range m.batches {
+			if !slices.ContainsFunc(b.items, func(item models.BatchItem) bool {
+				_, ok := m.jobs[item.JobID]
+				return ok
+			}) {
+				delete(m.batches, id)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
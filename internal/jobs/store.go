@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"claude-web-go/internal/models"
+)
+
+// record is a job as kept on disk. Prompts are never written; only what is
+// needed to report on the job.
+type record struct {
+	models.Job
+	// Owner is the user who submitted the job, empty for anonymous callers.
+	Owner string `json:"owner,omitempty"`
+	// Webhook is the job's own webhook, secret included, so it can still be
+	// told about the job after a restart.
+	Webhook *models.Webhook `json:"webhook,omitempty"`
+}
+
+func (r *record) finished() bool {
+	switch r.Status {
+	case models.JobCompleted, models.JobFailed, models.JobCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// store persists job records as one JSON file per job.
+type store struct {
+	dir string
+}
+
+func newStore(dir string) (*store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create jobs directory: %w", err)
+	}
+	return &store{dir: dir}, nil
+}
+
+// check creates and removes a file in the directory.
+func (s *store) check() error {
+	f, err := os.CreateTemp(s.dir, "incoming-*")
+	if err != nil {
+		return fmt.Errorf("jobs directory is not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func (s *store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// save writes r atomically, so a crash leaves either the old or the new
+// record.
+func (s *store) save(r *record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, "incoming-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(r.ID))
+}
+
+func (s *store) remove(id string) error {
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// load reads every record in the directory. Unreadable files are reported
+// and skipped.
+func (s *store) load() ([]*record, []error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var records []*record
+	var errs []error
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		var r record
+		if err := json.Unmarshal(data, &r); err != nil || r.ID == "" {
+			errs = append(errs, fmt.Errorf("invalid job record %s", name))
+			continue
+		}
+		records = append(records, &r)
+	}
+	return records, errs
+}
@@ -0,0 +1,24 @@
+package logger
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+type contextKey struct{}
+
+// WithContext returns a copy of ctx carrying entry, so code serving a
+// request logs with its fields.
+func WithContext(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, entry)
+}
+
+// FromContext returns the entry attached to ctx, or a bare entry of Log
+// outside a request.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if entry, ok := ctx.Value(contextKey{}).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(Log)
+}
@@ -2,6 +2,8 @@ package logger
 
 import (
 	"os"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -11,11 +13,19 @@ var Log *logrus.Logger
 func init() {
 	Log = logrus.New()
 	
-	// Set format
-	Log.SetFormatter(&logrus.TextFormatter{
-		FullTimestamp: true,
-		TimestampFormat: "2006-01-02 15:04:05",
-	})
+	// Set format; LOG_FORMAT=json writes one JSON object per line for log
+	// collectors
+	switch os.Getenv("LOG_FORMAT") {
+	case "json":
+		Log.SetFormatter(&logrus.JSONFormatter{
+			TimestampFormat: time.RFC3339Nano,
+		})
+	default:
+		Log.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp: true,
+			TimestampFormat: "2006-01-02 15:04:05",
+		})
+	}
 	
 	// Set output
 	Log.SetOutput(os.Stdout)
@@ -35,5 +45,16 @@ func init() {
 		Log.SetLevel(logrus.InfoLevel)
 	}
 	
-	Log.WithField("level", Log.Level).Info("Logger initialized")
+	// Mask secrets in every entry, including fields named in
+	// LOG_REDACT_FIELDS.
+	var redactFields []string
+	if fields := os.Getenv("LOG_REDACT_FIELDS"); fields != "" {
+		redactFields = strings.Split(fields, ",")
+	}
+	Log.AddHook(NewRedactHook(redactFields, ExcludeContent()))
+
+	Log.WithFields(logrus.Fields{
+		"level":          Log.Level,
+		"excludeContent": ExcludeContent(),
+	}).Info("Logger initialized")
 }
\ No newline at end of file
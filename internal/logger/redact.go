@@ -0,0 +1,136 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	redacted = "[REDACTED]"
+	omitted  = "[omitted]"
+)
+
+// ContentFields are the log fields that carry prompts, conversation
+// history or model output. The CLI's stderr is included because it echoes
+// tool input and file contents. LOG_EXCLUDE_CONTENT drops them.
+var ContentFields = []string{
+	"prompt",
+	"args",
+	"testArgs",
+	"stdout",
+	"stderr",
+	"fullOutput",
+	"outputPreview",
+}
+
+// defaultSensitiveFields are always masked, whatever their value.
+var defaultSensitiveFields = []string{
+	"password",
+	"secret",
+	"token",
+	"apiKey",
+	"authorization",
+	"ANTHROPIC_API_KEY",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+}
+
+// secretPatterns match secrets embedded in free text. The first group, if
+// any, is kept so the log still shows what was masked.
+var secretPatterns = []*regexp.Regexp{
+	// Anthropic API keys.
+	regexp.MustCompile(`(sk-ant-)[A-Za-z0-9_\-]{8,}`),
+	// AWS access key IDs; the secret keys and tokens that go with them
+	// are caught by the assignments below.
+	regexp.MustCompile(`\b((?:AKIA|ASIA)[A-Z0-9]{4})[A-Z0-9]{12}\b`),
+	// KEY=value and "key": "value" assignments of secret-looking names.
+	regexp.MustCompile(`(?i)((?:api[_-]?key|secret[_-]?access[_-]?key|session[_-]?token|secret|password|token)["']?\s*[:=]\s*["']?)[^\s"',}]+`),
+	// Authorization headers.
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/\-]+=*`),
+}
+
+// RedactHook masks secrets in log entries before they are written.
+type RedactHook struct {
+	sensitive      map[string]bool
+	content        map[string]bool
+	excludeContent bool
+}
+
+// NewRedactHook masks the default sensitive fields plus extraFields, and
+// drops content fields when excludeContent is set.
+func NewRedactHook(extraFields []string, excludeContent bool) *RedactHook {
+	h := &RedactHook{
+		sensitive:      make(map[string]bool),
+		content:        make(map[string]bool),
+		excludeContent: excludeContent,
+	}
+	for _, field := range append(defaultSensitiveFields, extraFields...) {
+		if field = strings.TrimSpace(field); field != "" {
+			h.sensitive[strings.ToLower(field)] = true
+		}
+	}
+	for _, field := range ContentFields {
+		h.content[strings.ToLower(field)] = true
+	}
+	return h
+}
+
+func (h *RedactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire rewrites the entry in place. logrus hands hooks a copy of the
+// entry's fields, so shared loggers are unaffected.
+func (h *RedactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = Redact(entry.Message)
+
+	for key, value := range entry.Data {
+		name := strings.ToLower(key)
+		switch {
+		case h.sensitive[name]:
+			entry.Data[key] = redacted
+		case h.excludeContent && h.content[name]:
+			entry.Data[key] = omitted
+		default:
+			entry.Data[key] = redactValue(value)
+		}
+	}
+	return nil
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return Redact(v)
+	case []string:
+		masked := make([]string, len(v))
+		for i, s := range v {
+			masked[i] = Redact(s)
+		}
+		return masked
+	case error:
+		return Redact(v.Error())
+	case fmt.Stringer:
+		return Redact(v.String())
+	default:
+		return value
+	}
+}
+
+// Redact masks secrets found in text.
+func Redact(text string) string {
+	for _, pattern := range secretPatterns {
+		text = pattern.ReplaceAllString(text, "${1}"+redacted)
+	}
+	return text
+}
+
+// ExcludeContent reports whether prompts and model output are kept out of
+// the logs.
+func ExcludeContent() bool {
+	return os.Getenv("LOG_EXCLUDE_CONTENT") == "true"
+}
@@ -0,0 +1,218 @@
+// Package metrics holds the server's Prometheus metrics. They are served
+// in the text exposition format at /metrics.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "claude_web"
+
+// durationBuckets cover everything from a static file to a claude run
+// that hits CLAUDE_MAX_TIMEOUT, in seconds.
+var durationBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800}
+
+var (
+	// HTTPRequests counts requests by route template, method and status.
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	// HTTPDuration is the time to serve a request, WebSocket connections
+	// included.
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to serve HTTP requests by route and method.",
+		Buckets:   durationBuckets,
+	}, []string{"route", "method"})
+
+	// ExecutorRuns counts chat requests by outcome, "ok" or an error code,
+	// and model.
+	ExecutorRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "executor_runs_total",
+		Help:      "Chat requests by outcome and model.",
+	}, []string{"outcome", "model"})
+	// ExecutorAttempts counts claude processes by outcome, including
+	// attempts that were retried.
+	ExecutorAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "executor_attempts_total",
+		Help:      "Claude processes by outcome, retried attempts included.",
+	}, []string{"outcome"})
+	// ExecutorRetries counts attempts after the first.
+	ExecutorRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "executor_retries_total",
+		Help:      "Claude processes started to retry a failed attempt.",
+	})
+	// ExecutorAttemptsPerRun is how many attempts chat requests took.
+	ExecutorAttemptsPerRun = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "executor_attempts_per_run",
+		Help:      "Attempts per chat request.",
+		Buckets:   []float64{0, 1, 2, 3, 5, 8},
+	})
+	// ExecutorInFlight is the number of chat requests being executed.
+	ExecutorInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "executor_in_flight",
+		Help:      "Chat requests currently executing.",
+	})
+	// SubprocessDuration is how long single claude processes ran, by
+	// outcome.
+	SubprocessDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "executor_subprocess_duration_seconds",
+		Help:      "Run time of claude processes by outcome.",
+		Buckets:   durationBuckets,
+	}, []string{"outcome"})
+	// Tokens counts the tokens claude reported using, by model and type:
+	// input, output, cache_read or cache_creation.
+	Tokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_total",
+		Help:      "Tokens used by model and type.",
+	}, []string{"model", "type"})
+	// Cost counts the cost claude reported, in US dollars, by model.
+	Cost = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cost_usd_total",
+		Help:      "Cost reported by claude in US dollars, by model.",
+	}, []string{"model"})
+
+	// JobsQueued is the number of background jobs waiting for a worker.
+	JobsQueued = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "jobs_queued",
+		Help:      "Background jobs waiting for a worker.",
+	})
+
+	// BreakerState is 1 for each backend's current circuit breaker state
+	// and 0 for the others.
+	BreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "breaker_state",
+		Help:      "Circuit breaker state by backend; 1 marks the current state.",
+	}, []string{"backend", "state"})
+	// BreakerRejected counts requests failed fast by an open breaker, by
+	// backend.
+	BreakerRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "breaker_rejected_total",
+		Help:      "Requests failed fast by an open circuit breaker, by backend.",
+	}, []string{"backend"})
+
+	// CredentialRefreshes counts credential fetches by outcome, "ok" or
+	// "error".
+	CredentialRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "credential_refreshes_total",
+		Help:      "Credential fetches by outcome.",
+	}, []string{"outcome"})
+)
+
+// breakerStates are the states BreakerState reports for every backend.
+var breakerStates = []string{"closed", "open", "half_open"}
+
+// Handler serves every registered metric.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RecordRun counts a finished chat request.
+func RecordRun(outcome, model string, attempts int) {
+	ExecutorRuns.WithLabelValues(outcome, model).Inc()
+	ExecutorAttemptsPerRun.Observe(float64(attempts))
+}
+
+// RecordUsage counts the tokens and cost of a claude run.
+func RecordUsage(model string, input, output, cacheRead, cacheCreation int64, costUSD float64) {
+	Tokens.WithLabelValues(model, "input").Add(float64(input))
+	Tokens.WithLabelValues(model, "output").Add(float64(output))
+	Tokens.WithLabelValues(model, "cache_read").Add(float64(cacheRead))
+	Tokens.WithLabelValues(model, "cache_creation").Add(float64(cacheCreation))
+	Cost.WithLabelValues(model).Add(costUSD)
+}
+
+// SetBreakerState records a backend's circuit breaker state.
+func SetBreakerState(backend, state string) {
+	for _, s := range breakerStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		BreakerState.WithLabelValues(backend, s).Set(value)
+	}
+}
+
+var (
+	fileStoreDesc = prometheus.NewDesc(namespace+"_file_store_bytes",
+		"Bytes of file versions kept in the file store.", nil, nil)
+	sessionsDesc = prometheus.NewDesc(namespace+"_file_store_sessions",
+		"Sessions with files in the file store.", nil, nil)
+	expiryDesc = prometheus.NewDesc(namespace+"_credential_expiry_seconds",
+		"Seconds until a provider's cached credentials expire; absent for credentials that don't expire.",
+		[]string{"provider"}, nil)
+)
+
+// sampled reports values that are read when scraped, from functions the
+// packages owning them register.
+type sampled struct {
+	mu          sync.Mutex
+	fileStore   func() (sessions int, bytes int64)
+	credentials map[string]func() time.Time
+}
+
+var samples = &sampled{credentials: make(map[string]func() time.Time)}
+
+func init() {
+	prometheus.MustRegister(samples)
+}
+
+// WatchFileStore reports the file store's usage through usage, replacing
+// any function registered before.
+func WatchFileStore(usage func() (sessions int, bytes int64)) {
+	samples.mu.Lock()
+	defer samples.mu.Unlock()
+	samples.fileStore = usage
+}
+
+// WatchCredentials reports the time to expiry of a provider's credentials
+// through expiration, which returns the zero time for credentials that
+// don't expire or haven't been fetched.
+func WatchCredentials(provider string, expiration func() time.Time) {
+	samples.mu.Lock()
+	defer samples.mu.Unlock()
+	samples.credentials[provider] = expiration
+}
+
+func (s *sampled) Describe(ch chan<- *prometheus.Desc) {
+	ch <- fileStoreDesc
+	ch <- sessionsDesc
+	ch <- expiryDesc
+}
+
+func (s *sampled) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fileStore != nil {
+		sessions, bytes := s.fileStore()
+		ch <- prometheus.MustNewConstMetric(sessionsDesc, prometheus.GaugeValue, float64(sessions))
+		ch <- prometheus.MustNewConstMetric(fileStoreDesc, prometheus.GaugeValue, float64(bytes))
+	}
+	for provider, expiration := range s.credentials {
+		if expires := expiration(); !expires.IsZero() {
+			ch <- prometheus.MustNewConstMetric(expiryDesc, prometheus.GaugeValue, time.Until(expires).Seconds(), provider)
+		}
+	}
+}
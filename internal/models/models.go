@@ -11,21 +11,393 @@ type Message struct {
 }
 
 type File struct {
-	Name     string `json:"name"`
-	Path     string `json:"path"`
-	MimeType string `json:"mimeType"`
-	Size     int64  `json:"size"`
+	Name        string `json:"name"`
+	Path        string `json:"path"`
+	MimeType    string `json:"mimeType"`
+	Size        int64  `json:"size"`
+	Previewable bool   `json:"previewable"`
+	Language    string `json:"language,omitempty"`
+	Version     string `json:"version,omitempty"`
+}
+
+type FileVersion struct {
+	ID       string    `json:"id"`
+	URL      string    `json:"url"`
+	MimeType string    `json:"mimeType"`
+	Size     int64     `json:"size"`
+	StoredAt time.Time `json:"storedAt"`
+}
+
+// SkippedFile is an output file that was found but not returned, with the
+// reason it was left out.
+type SkippedFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size,omitempty"`
+	Reason string `json:"reason"`
 }
 
 type ChatRequest struct {
 	Message       string    `json:"message"`
 	SessionID     string    `json:"sessionId"`
 	ContextWindow []Message `json:"contextWindow"`
+	// Profile selects a configured execution profile; empty means the
+	// default.
+	Profile string `json:"profile,omitempty"`
+	// TimeoutSeconds asks for a different deadline than the profile's,
+	// capped by the server's maximum.
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
 }
 
+// Response statuses.
+const (
+	StatusCompleted = "completed"
+	// StatusTimedOut means the message holds the partial output produced
+	// before the deadline.
+	StatusTimedOut = "timed_out"
+)
+
 type ChatResponse struct {
-	SessionID string    `json:"sessionId"`
-	Message   Message   `json:"message"`
-	Files     []File    `json:"files"`
-	Error     string    `json:"error,omitempty"`
-}
\ No newline at end of file
+	SessionID string        `json:"sessionId"`
+	Message   Message       `json:"message"`
+	Files     []File        `json:"files"`
+	Skipped   []SkippedFile `json:"skippedFiles,omitempty"`
+	Status    string        `json:"status,omitempty"`
+	// Metadata describes how the message was produced.
+	Metadata *ResponseMetadata `json:"metadata,omitempty"`
+	// Error is a message safe to show to users; ErrorCode identifies the
+	// kind of failure, and Retryable says whether sending the same request
+	// again may succeed.
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"`
+	// TraceID identifies the trace of the request that produced the
+	// message.
+	TraceID string `json:"traceId,omitempty"`
+}
+
+// ResponseMetadata records where a message was served.
+type ResponseMetadata struct {
+	Profile  string `json:"profile,omitempty"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	// Region is the Bedrock region that served the message.
+	Region string `json:"region,omitempty"`
+	// Attempts is how many times claude was run, retries included.
+	Attempts int `json:"attempts"`
+	// Usage is what the successful run consumed, as claude reported it.
+	// It is missing when the run was stopped before reporting.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Usage is the tokens and cost of a claude run.
+type Usage struct {
+	InputTokens  int64   `json:"inputTokens"`
+	OutputTokens int64   `json:"outputTokens"`
+	CostUSD      float64 `json:"costUsd"`
+}
+
+// Job statuses.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// Job is a chat request run in the background. Response is set once the
+// run has finished.
+type Job struct {
+	ID        string        `json:"id"`
+	SessionID string        `json:"sessionId"`
+	Profile   string        `json:"profile,omitempty"`
+	Status    string        `json:"status"`
+	Response  *ChatResponse `json:"response,omitempty"`
+	Usage     *JobUsage     `json:"usage,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	ErrorCode string        `json:"errorCode,omitempty"`
+	// WebhookID identifies the job's own webhook, for its delivery log.
+	WebhookID  string     `json:"webhookId,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// JobRequest is the body of a job submission: a chat request, optionally
+// with a webhook to notify about this job only.
+type JobRequest struct {
+	ChatRequest
+	Webhook *Webhook `json:"webhook,omitempty"`
+}
+
+// JobUsage records what a finished job consumed.
+type JobUsage struct {
+	Attempts     int     `json:"attempts"`
+	DurationMs   int64   `json:"durationMs"`
+	InputTokens  int64   `json:"inputTokens"`
+	OutputTokens int64   `json:"outputTokens"`
+	CostUSD      float64 `json:"costUsd"`
+}
+
+// Batch statuses. A finished batch may include failed items; its counts
+// tell.
+const (
+	BatchRunning  = "running"
+	BatchFinished = "finished"
+)
+
+// BatchRequest runs Template once per set of variables in Items. The
+// template refers to variables as {{name}}.
+type BatchRequest struct {
+	Template       string              `json:"template"`
+	Items          []map[string]string `json:"items"`
+	Profile        string              `json:"profile,omitempty"`
+	TimeoutSeconds int                 `json:"timeoutSeconds,omitempty"`
+}
+
+// Batch is a prompt template run as one job per set of variables.
+type Batch struct {
+	ID       string `json:"id"`
+	Template string `json:"template"`
+	Profile  string `json:"profile,omitempty"`
+	Status   string `json:"status"`
+	// Counts is the number of items in each job status.
+	Counts    map[string]int `json:"counts"`
+	Items     []BatchItem    `json:"items"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// BatchItem is one set of variables of a batch and the job running it.
+type BatchItem struct {
+	// Index is the item's position in the input, starting at 1.
+	Index     int               `json:"index"`
+	Variables map[string]string `json:"variables"`
+	JobID     string            `json:"jobId"`
+	SessionID string            `json:"sessionId"`
+	Status    string            `json:"status"`
+	Error     string            `json:"error,omitempty"`
+	ErrorCode string            `json:"errorCode,omitempty"`
+}
+
+// BatchResult is an item's entry in a batch's results.json.
+type BatchResult struct {
+	BatchItem
+	Output string `json:"output"`
+	// Files are the item's files, named as in the results archive.
+	Files []string `json:"files"`
+}
+
+// What a schedule does about runs missed while the server was down.
+const (
+	MissedRunOnce = "run_once"
+	MissedSkip    = "skip"
+)
+
+// How a schedule run was started.
+const (
+	TriggerSchedule = "schedule"
+	TriggerCatchUp  = "catch_up"
+	TriggerManual   = "manual"
+)
+
+// Schedule run statuses besides the job statuses.
+const (
+	RunMissed  = "missed"
+	RunSkipped = "skipped"
+)
+
+// Schedule runs a prompt as a job whenever its cron expression fires.
+type Schedule struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Cron is a five-field cron expression or a macro such as @daily,
+	// evaluated in Timezone (UTC when empty).
+	Cron     string `json:"cron"`
+	Timezone string `json:"timezone,omitempty"`
+	// Prompt may use {{name}} for Inputs and for the built-in date,
+	// yesterday and scheduled_at variables.
+	Prompt  string            `json:"prompt"`
+	Profile string            `json:"profile,omitempty"`
+	Inputs  map[string]string `json:"inputs,omitempty"`
+	// SessionID is the conversation that receives the results and files.
+	SessionID string `json:"sessionId"`
+	// Webhook, if set, is notified about every run. Its secret is never
+	// returned.
+	Webhook    *Webhook   `json:"webhook,omitempty"`
+	MissedRuns string     `json:"missedRuns"`
+	Paused     bool       `json:"paused,omitempty"`
+	NextRunAt  *time.Time `json:"nextRunAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	// History holds the most recent runs, oldest first.
+	History []ScheduleRun `json:"history,omitempty"`
+}
+
+// ScheduleRun is one entry of a schedule's history.
+type ScheduleRun struct {
+	ScheduledAt time.Time  `json:"scheduledAt"`
+	Trigger     string     `json:"trigger"`
+	JobID       string     `json:"jobId,omitempty"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Webhook events.
+const (
+	EventJobCompleted     = "job.completed"
+	EventJobFailed        = "job.failed"
+	EventJobCancelled     = "job.cancelled"
+	EventMessageCompleted = "message.completed"
+	EventMessageFailed    = "message.failed"
+	EventFileCreated      = "file.created"
+	// EventTest is only sent by the test endpoint.
+	EventTest = "test"
+)
+
+// Webhook is a subscription to events. Secret signs the payloads and is
+// only returned when the webhook is created.
+type Webhook struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	// Events limits the subscription to these event types; empty means all.
+	Events    []string  `json:"events,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookEvent is the JSON payload POSTed to webhooks.
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// FileCreatedEvent is the data of a file.created event.
+type FileCreatedEvent struct {
+	SessionID string `json:"sessionId"`
+	JobID     string `json:"jobId,omitempty"`
+	File      File   `json:"file"`
+}
+
+// Webhook delivery statuses.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is the delivery log entry for one event sent to one
+// webhook.
+type WebhookDelivery struct {
+	ID        string `json:"id"`
+	WebhookID string `json:"webhookId"`
+	EventID   string `json:"eventId"`
+	Event     string `json:"event"`
+	Status    string `json:"status"`
+	Attempts  int    `json:"attempts"`
+	// ResponseStatus is the HTTP status of the last attempt, if it got a
+	// response.
+	ResponseStatus int       `json:"responseStatus,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// ErrorResponse is returned by endpoints that have no other body to carry
+// an error.
+type ErrorResponse struct {
+	Error     string `json:"error"`
+	ErrorCode string `json:"errorCode,omitempty"`
+}
+
+type SessionFilesResponse struct {
+	SessionID string `json:"sessionId"`
+	Files     []File `json:"files"`
+}
+
+type FileVersionsResponse struct {
+	SessionID string        `json:"sessionId"`
+	Name      string        `json:"name"`
+	Versions  []FileVersion `json:"versions"`
+}
+
+type HealthResponse struct {
+	Status      string           `json:"status"`
+	Credentials CredentialHealth `json:"credentials"`
+	// Backends reports each provider's circuit breaker.
+	Backends map[string]BackendHealth `json:"backends"`
+}
+
+type BackendHealth struct {
+	Breaker             string     `json:"breaker"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	RetryAt             *time.Time `json:"retryAt,omitempty"`
+}
+
+type CredentialHealth struct {
+	Valid       bool      `json:"valid"`
+	ExpiresAt   time.Time `json:"expiresAt,omitempty"`
+	ExpiresIn   string    `json:"expiresIn,omitempty"`
+	LastRefresh time.Time `json:"lastRefresh,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// ReadinessResponse reports whether the instance should receive traffic.
+// Status is "ready" or "not_ready".
+type ReadinessResponse struct {
+	Status string                    `json:"status"`
+	Checks map[string]ReadinessCheck `json:"checks"`
+}
+
+type ReadinessCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type DiagnosticsResponse struct {
+	ReadinessResponse
+	StartedAt time.Time `json:"startedAt"`
+	Uptime    string    `json:"uptime"`
+	GoVersion string    `json:"goVersion"`
+	CLI       CLIHealth `json:"cli"`
+	// Providers reports each provider's cached credentials.
+	Providers map[string]CredentialHealth `json:"providers"`
+	Backends  map[string]BackendHealth    `json:"backends"`
+	Jobs      JobsHealth                  `json:"jobs"`
+	FileStore FileStoreHealth             `json:"fileStore"`
+	// Probe is set when a live prompt was requested.
+	Probe *ProbeHealth `json:"probe,omitempty"`
+}
+
+type CLIHealth struct {
+	Path    string `json:"path,omitempty"`
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type JobsHealth struct {
+	Queued int `json:"queued"`
+	// Background is queued batch items and schedule runs, which don't
+	// count towards MaxQueued.
+	Background int `json:"background"`
+	Running    int `json:"running"`
+	MaxQueued  int `json:"maxQueued"`
+}
+
+type FileStoreHealth struct {
+	Sessions int   `json:"sessions"`
+	Bytes    int64 `json:"bytes"`
+}
+
+type ProbeHealth struct {
+	OK        bool    `json:"ok"`
+	Profile   string  `json:"profile,omitempty"`
+	Provider  string  `json:"provider"`
+	Model     string  `json:"model"`
+	Duration  string  `json:"duration"`
+	Output    string  `json:"output,omitempty"`
+	CostUSD   float64 `json:"costUsd,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	ErrorCode string  `json:"errorCode,omitempty"`
+}
@@ -0,0 +1,201 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	// Schedules name IANA time zones, which must resolve even in images
+	// without a zoneinfo database.
+	_ "time/tzdata"
+)
+
+// cronSpec is a parsed five-field cron expression: minute, hour, day of
+// month, month and day of week. Each field is a bitmask of allowed values.
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	// When both day fields are restricted, a day matching either runs, as
+	// in Vixie cron.
+	domStar, dowStar bool
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// parseCron parses a five-field expression or one of the @ macros. Fields
+// accept *, values, ranges (1-5), steps (*/15, 1-30/5) and comma lists;
+// months and days of week also accept three-letter names, and 7 is Sunday.
+func parseCron(expr string) (*cronSpec, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := macros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	spec := &cronSpec{
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+	var err error
+	if spec.minute, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if spec.hour, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if spec.dom, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if spec.month, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if spec.dow, err = parseField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	// 7 is another name for Sunday.
+	if spec.dow&(1<<7) != 0 {
+		spec.dow = spec.dow&^(1<<7) | 1
+	}
+	return spec, nil
+}
+
+func parseField(field string, low, high int, names map[string]int) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart, step = part[:i], n
+		}
+
+		start, end := low, high
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if start, err = parseValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(bounds[1], names); err != nil {
+				return 0, err
+			}
+		default:
+			value, err := parseValue(rangePart, names)
+			if err != nil {
+				return 0, err
+			}
+			start = value
+			// "5/10" means from 5 to the end in steps of 10.
+			if step == 1 {
+				end = value
+			}
+		}
+		if start < low || end > high || start > end {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, low, high)
+		}
+
+		for v := start; v <= end; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return mask, nil
+}
+
+func parseValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// next returns the first time after t, to the minute, that the expression
+// matches in t's location, or the zero time if there is none within five
+// years.
+func (c *cronSpec) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	limit := t.Year() + 5
+
+wrap:
+	if t.Year() > limit {
+		return time.Time{}
+	}
+
+	for c.month&(1<<uint(t.Month())) == 0 {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !c.dayMatches(t) {
+		day := t.Day()
+		t = time.Date(t.Year(), t.Month(), day+1, 0, 0, 0, 0, loc)
+		// Where a DST change skips midnight, time.Date may land back on
+		// the previous day.
+		for t.Day() == day {
+			t = t.Add(time.Hour)
+		}
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for c.hour&(1<<uint(t.Hour())) == 0 {
+		// Stepping in absolute time, rather than asking time.Date for the
+		// next hour, steps over hours skipped by DST and through hours
+		// repeated by it; time.Date would pick the first of a repeated
+		// hour again and again.
+		t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	for c.minute&(1<<uint(t.Minute())) == 0 {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	return t
+}
+
+func (c *cronSpec) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNextAcrossDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, newYork)
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{
+			name:  "fall back, from the day before",
+			expr:  "0 3 * * *",
+			after: at(2026, time.October, 31, 3, 1),
+			want:  at(2026, time.November, 1, 3, 0),
+		},
+		{
+			name:  "fall back, from before the repeated hour",
+			expr:  "0 3 * * *",
+			after: at(2026, time.November, 1, 0, 30),
+			want:  at(2026, time.November, 1, 3, 0),
+		},
+		{
+			name:  "fall back, from the second pass of the repeated hour",
+			expr:  "0 3 * * *",
+			after: time.Date(2026, time.November, 1, 6, 30, 0, 0, time.UTC).In(newYork),
+			want:  at(2026, time.November, 1, 3, 0),
+		},
+		{
+			name:  "fall back, hourly",
+			expr:  "0 * * * *",
+			after: at(2026, time.November, 1, 1, 30),
+			want:  time.Date(2026, time.November, 1, 6, 0, 0, 0, time.UTC).In(newYork),
+		},
+		{
+			name:  "spring forward, hour after the gap",
+			expr:  "0 3 * * *",
+			after: at(2026, time.March, 7, 3, 1),
+			want:  at(2026, time.March, 8, 3, 0),
+		},
+		{
+			name:  "spring forward, skipped hour",
+			expr:  "30 2 * * *",
+			after: at(2026, time.March, 8, 0, 0),
+			want:  at(2026, time.March, 9, 2, 30),
+		},
+		{
+			name:  "spring forward, hourly",
+			expr:  "15 * * * *",
+			after: at(2026, time.March, 8, 1, 20),
+			want:  at(2026, time.March, 8, 3, 15),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan time.Time, 1)
+			go func() { done <- spec.next(tt.after) }()
+			select {
+			case got := <-done:
+				if !got.Equal(tt.want) {
+					t.Errorf("next(%s) = %s, want %s", tt.after, got, tt.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("next(%s) did not return", tt.after)
+			}
+		})
+	}
+}
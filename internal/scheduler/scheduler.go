@@ -0,0 +1,689 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"claude-web-go/internal/auth"
+	"claude-web-go/internal/jobs"
+	"claude-web-go/internal/logger"
+	"claude-web-go/internal/models"
+	"claude-web-go/internal/webhooks"
+	"github.com/google/uuid"
+)
+
+const defaultFile = "/tmp/claude-web-schedules.json"
+
+// maxHistory is how many runs are kept per schedule.
+const maxHistory = 50
+
+// maxWait bounds how long the loop sleeps, so clock changes and suspends
+// are noticed within a minute.
+const maxWait = time.Minute
+
+var (
+	ErrNotFound = errors.New("schedule not found")
+	// ErrInvalid wraps the reasons a schedule definition is rejected.
+	ErrInvalid = errors.New("invalid schedule")
+	// ErrAnonymous is returned when a caller without an identity tries to
+	// create a schedule. Anonymous callers would all share the empty
+	// owner, and with it each other's schedules.
+	ErrAnonymous = errors.New("schedules require an authenticated user")
+)
+
+// entry is a schedule as kept in SCHEDULES_FILE, with the identity its
+// runs use.
+type entry struct {
+	models.Schedule
+	Owner  string   `json:"owner"`
+	Groups []string `json:"groups,omitempty"`
+
+	spec *cronSpec
+	loc  *time.Location
+}
+
+// due is a run to submit, collected under the lock and submitted without
+// it.
+type due struct {
+	id          string
+	scheduledAt time.Time
+	trigger     string
+}
+
+// Scheduler runs stored prompts as jobs on cron schedules. Schedules and
+// their history are kept in SCHEDULES_FILE, so runs missed while the
+// server was down are handled at the next start according to each
+// schedule's missedRuns policy.
+//
+// The scheduler never calls the job manager while holding its own lock,
+// since the manager calls JobFinished while holding its lock.
+type Scheduler struct {
+	path string
+	jobs *jobs.Manager
+	wake chan struct{}
+	// stop ends the loop, which closes stopped on its way out.
+	stop    chan struct{}
+	stopped chan struct{}
+
+	mu        sync.Mutex
+	schedules map[string]*entry
+}
+
+func New() (*Scheduler, error) {
+	path := os.Getenv("SCHEDULES_FILE")
+	if path == "" {
+		path = defaultFile
+	}
+
+	s := &Scheduler{
+		path:      path,
+		wake:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		schedules: make(map[string]*entry),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Start handles the runs missed while the server was down and starts the
+// scheduling loop. Runs are submitted to manager.
+func (s *Scheduler) Start(manager *jobs.Manager) {
+	s.jobs = manager
+	s.settle()
+
+	now := time.Now()
+	var runs []due
+	s.mu.Lock()
+	for _, e := range s.schedules {
+		if e.Paused || e.NextRunAt == nil || e.NextRunAt.After(now) {
+			continue
+		}
+		missed := *e.NextRunAt
+		if e.MissedRuns == models.MissedSkip {
+			s.record(e, models.ScheduleRun{
+				ScheduledAt: missed,
+				Trigger:     models.TriggerCatchUp,
+				Status:      models.RunMissed,
+				Error:       "The server was down at the scheduled time.",
+			})
+		} else {
+			runs = append(runs, due{id: e.ID, scheduledAt: missed, trigger: models.TriggerCatchUp})
+		}
+		e.advance(now)
+		logger.Log.WithFields(map[string]interface{}{
+			"scheduleID":  e.ID,
+			"scheduledAt": missed,
+			"policy":      e.MissedRuns,
+		}).Warn("Schedule missed a run while the server was down")
+	}
+	s.saveLocked()
+	s.mu.Unlock()
+
+	for _, run := range runs {
+		s.submit(run)
+	}
+
+	go s.loop()
+}
+
+// settle brings history entries still queued or running up to date with
+// their jobs. Those entries only change when a job finishes, so a run
+// whose job record is gone, or whose outcome was lost when the previous
+// process stopped, would otherwise hold back every later run.
+func (s *Scheduler) settle() {
+	type open struct {
+		ctx   context.Context
+		jobID string
+	}
+	var runs []open
+	s.mu.Lock()
+	for _, e := range s.schedules {
+		for _, run := range e.History {
+			if run.FinishedAt == nil && (run.Status == models.JobQueued || run.Status == models.JobRunning) {
+				runs = append(runs, open{ctx: e.context(), jobID: run.JobID})
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, run := range runs {
+		job, err := s.jobs.Get(run.ctx, run.jobID)
+		if err != nil {
+			now := time.Now()
+			job = models.Job{
+				ID:         run.jobID,
+				Status:     models.JobFailed,
+				Error:      "The run's job no longer exists.",
+				FinishedAt: &now,
+			}
+			logger.Log.WithField("jobID", run.jobID).Warn("Schedule run's job is missing, marking the run failed")
+		}
+		s.JobFinished(job)
+	}
+}
+
+// Stop ends the scheduling loop, waiting for runs it is submitting. Runs
+// that come due while the server is down are handled by the next Start.
+// It must only be called after Start.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.stopped
+}
+
+func (s *Scheduler) loop() {
+	defer close(s.stopped)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-timer.C:
+		case <-s.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+
+		now := time.Now()
+		var runs []due
+		wait := maxWait
+		s.mu.Lock()
+		for _, e := range s.schedules {
+			if e.Paused || e.NextRunAt == nil {
+				continue
+			}
+			if !e.NextRunAt.After(now) {
+				runs = append(runs, due{id: e.ID, scheduledAt: *e.NextRunAt, trigger: models.TriggerSchedule})
+				e.advance(now)
+			}
+			if e.NextRunAt != nil && e.NextRunAt.Sub(now) < wait {
+				wait = e.NextRunAt.Sub(now)
+			}
+		}
+		if len(runs) > 0 {
+			s.saveLocked()
+		}
+		s.mu.Unlock()
+
+		for _, run := range runs {
+			s.submit(run)
+		}
+		timer.Reset(wait)
+	}
+}
+
+// submit starts a run as a job, unless the schedule's previous run is
+// still going.
+func (s *Scheduler) submit(run due) {
+	s.mu.Lock()
+	e, ok := s.schedules[run.id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	if last := lastRun(e); last != nil && (last.Status == models.JobQueued || last.Status == models.JobRunning) {
+		s.record(e, models.ScheduleRun{
+			ScheduledAt: run.scheduledAt,
+			Trigger:     run.trigger,
+			Status:      models.RunSkipped,
+			Error:       "The previous run had not finished.",
+		})
+		s.saveLocked()
+		s.mu.Unlock()
+		logger.Log.WithField("scheduleID", e.ID).Warn("Skipping schedule run while the previous one is still going")
+		return
+	}
+	ctx := e.context()
+	req, webhook, err := e.request(run.scheduledAt)
+	s.mu.Unlock()
+
+	var job models.Job
+	if err == nil {
+		job, err = s.jobs.SubmitBackground(ctx, req, webhook)
+	}
+
+	s.mu.Lock()
+	e, ok = s.schedules[run.id]
+	if ok {
+		entry := models.ScheduleRun{
+			ScheduledAt: run.scheduledAt,
+			Trigger:     run.trigger,
+			JobID:       job.ID,
+			Status:      models.JobQueued,
+		}
+		if err != nil {
+			now := time.Now()
+			entry.Status = models.JobFailed
+			entry.Error = err.Error()
+			entry.FinishedAt = &now
+		}
+		s.record(e, entry)
+		s.saveLocked()
+	}
+	s.mu.Unlock()
+
+	log := logger.Log.WithFields(map[string]interface{}{
+		"scheduleID": run.id,
+		"trigger":    run.trigger,
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to start schedule run")
+		return
+	}
+	log.WithField("jobID", job.ID).Info("Schedule run queued")
+
+	// The job may have finished before it was in the history.
+	if current, err := s.jobs.Get(ctx, job.ID); err == nil {
+		s.JobFinished(current)
+	}
+}
+
+// JobFinished updates the history entry of a run when its job finishes.
+// Jobs that aren't schedule runs are ignored.
+func (s *Scheduler) JobFinished(job models.Job) {
+	switch job.Status {
+	case models.JobCompleted, models.JobFailed, models.JobCancelled:
+	default:
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.schedules {
+		for i := range e.History {
+			run := &e.History[i]
+			if run.JobID != job.ID || run.FinishedAt != nil {
+				continue
+			}
+			run.Status = job.Status
+			run.Error = job.Error
+			run.FinishedAt = job.FinishedAt
+			s.saveLocked()
+			return
+		}
+	}
+}
+
+// Create stores a new schedule owned by the caller. Anonymous callers
+// can't create schedules.
+func (s *Scheduler) Create(ctx context.Context, schedule models.Schedule) (models.Schedule, error) {
+	identity := auth.IdentityFromContext(ctx)
+	if identity == nil || identity.User == "" {
+		return models.Schedule{}, ErrAnonymous
+	}
+	schedule.ID = uuid.New().String()
+	schedule.CreatedAt = time.Now()
+	schedule.History = nil
+	if schedule.SessionID == "" {
+		schedule.SessionID = uuid.New().String()
+	}
+
+	e := &entry{Schedule: schedule, Owner: identity.User, Groups: identity.Groups}
+	if err := e.prepare(); err != nil {
+		return models.Schedule{}, err
+	}
+	if e.Webhook != nil {
+		hook, err := webhooks.NewJobWebhook(ctx, *e.Webhook)
+		if err != nil {
+			return models.Schedule{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		e.Webhook = hook
+	}
+	e.advance(time.Now())
+
+	s.mu.Lock()
+	s.schedules[e.ID] = e
+	err := s.save()
+	if err != nil {
+		delete(s.schedules, e.ID)
+	}
+	view := e.view()
+	s.mu.Unlock()
+	if err != nil {
+		return models.Schedule{}, err
+	}
+
+	s.notify()
+	logger.FromContext(ctx).WithFields(map[string]interface{}{
+		"scheduleID": view.ID,
+		"cron":       view.Cron,
+		"nextRunAt":  view.NextRunAt,
+	}).Info("Schedule created")
+	return view, nil
+}
+
+// Update replaces a schedule's definition, keeping its ID, history and,
+// unless a new one is given, its webhook.
+func (s *Scheduler) Update(ctx context.Context, id string, schedule models.Schedule) (models.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.visible(ctx, id)
+	if !ok {
+		return models.Schedule{}, ErrNotFound
+	}
+
+	schedule.ID = current.ID
+	schedule.CreatedAt = current.CreatedAt
+	schedule.History = current.History
+	if schedule.SessionID == "" {
+		schedule.SessionID = current.SessionID
+	}
+	e := &entry{Schedule: schedule, Owner: current.Owner, Groups: current.Groups}
+	if err := e.prepare(); err != nil {
+		return models.Schedule{}, err
+	}
+	if e.Webhook != nil {
+		hook, err := webhooks.NewJobWebhook(ctx, *e.Webhook)
+		if err != nil {
+			return models.Schedule{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		e.Webhook = hook
+	} else {
+		e.Webhook = current.Webhook
+	}
+	e.advance(time.Now())
+
+	s.schedules[id] = e
+	if err := s.save(); err != nil {
+		s.schedules[id] = current
+		return models.Schedule{}, err
+	}
+	s.notify()
+	logger.FromContext(ctx).WithField("scheduleID", id).Info("Schedule updated")
+	return e.view(), nil
+}
+
+func (s *Scheduler) Get(ctx context.Context, id string) (models.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.visible(ctx, id)
+	if !ok {
+		return models.Schedule{}, ErrNotFound
+	}
+	return e.view(), nil
+}
+
+// List returns the caller's schedules, without their history.
+func (s *Scheduler) List(ctx context.Context) []models.Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules := []models.Schedule{}
+	for _, e := range s.schedules {
+		if e.Owner == auth.UserFromContext(ctx) {
+			view := e.view()
+			view.History = nil
+			schedules = append(schedules, view)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+	})
+	return schedules
+}
+
+func (s *Scheduler) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.visible(ctx, id)
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.schedules, id)
+	if err := s.save(); err != nil {
+		s.schedules[id] = e
+		return err
+	}
+	logger.FromContext(ctx).WithField("scheduleID", id).Info("Schedule deleted")
+	return nil
+}
+
+// RunNow starts a run at once, outside the schedule.
+func (s *Scheduler) RunNow(ctx context.Context, id string) (models.Schedule, error) {
+	s.mu.Lock()
+	_, ok := s.visible(ctx, id)
+	s.mu.Unlock()
+	if !ok {
+		return models.Schedule{}, ErrNotFound
+	}
+
+	s.submit(due{id: id, scheduledAt: time.Now(), trigger: models.TriggerManual})
+	return s.Get(ctx, id)
+}
+
+// visible returns the schedule if it belongs to the caller. Callers must
+// hold s.mu.
+func (s *Scheduler) visible(ctx context.Context, id string) (*entry, bool) {
+	e, ok := s.schedules[id]
+	if !ok || e.Owner != auth.UserFromContext(ctx) {
+		return nil, false
+	}
+	return e, true
+}
+
+// notify wakes the loop to pick up a new or changed schedule.
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// record appends a run to the history, dropping the oldest beyond
+// maxHistory. Callers must hold s.mu.
+func (s *Scheduler) record(e *entry, run models.ScheduleRun) {
+	e.History = append(e.History, run)
+	if len(e.History) > maxHistory {
+		e.History = e.History[len(e.History)-maxHistory:]
+	}
+}
+
+// advance moves the schedule's next run past now.
+func (e *entry) advance(now time.Time) {
+	next := e.spec.next(now.In(e.loc))
+	if next.IsZero() {
+		e.NextRunAt = nil
+		return
+	}
+	e.NextRunAt = &next
+}
+
+// prepare validates the definition, fills in defaults and parses the cron
+// expression.
+func (e *entry) prepare() error {
+	e.Name = strings.TrimSpace(e.Name)
+	if e.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if strings.TrimSpace(e.Prompt) == "" {
+		return fmt.Errorf("%w: prompt is required", ErrInvalid)
+	}
+	switch e.MissedRuns {
+	case "":
+		e.MissedRuns = models.MissedRunOnce
+	case models.MissedRunOnce, models.MissedSkip:
+	default:
+		return fmt.Errorf("%w: missedRuns must be %s or %s", ErrInvalid, models.MissedRunOnce, models.MissedSkip)
+	}
+	if err := e.compile(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if e.spec.next(time.Now().In(e.loc)).IsZero() {
+		return fmt.Errorf("%w: cron expression %q never fires", ErrInvalid, e.Cron)
+	}
+	if _, err := jobs.RenderTemplate(e.Prompt, e.variables(time.Now())); err != nil {
+		return fmt.Errorf("%w: prompt uses an %v", ErrInvalid, err)
+	}
+	return nil
+}
+
+// compile parses the cron expression and time zone.
+func (e *entry) compile() error {
+	spec, err := parseCron(e.Cron)
+	if err != nil {
+		return err
+	}
+	loc := time.UTC
+	if e.Timezone != "" {
+		if loc, err = time.LoadLocation(e.Timezone); err != nil {
+			return fmt.Errorf("unknown time zone %q", e.Timezone)
+		}
+	}
+	e.spec = spec
+	e.loc = loc
+	return nil
+}
+
+// variables returns the inputs plus the built-in variables for a run
+// scheduled at scheduledAt. Inputs take precedence.
+func (e *entry) variables(scheduledAt time.Time) map[string]string {
+	local := scheduledAt.In(e.loc)
+	vars := map[string]string{
+		"date":         local.Format("2006-01-02"),
+		"yesterday":    local.AddDate(0, 0, -1).Format("2006-01-02"),
+		"scheduled_at": local.Format(time.RFC3339),
+	}
+	for name, value := range e.Inputs {
+		vars[name] = value
+	}
+	return vars
+}
+
+// request builds the job for a run.
+func (e *entry) request(scheduledAt time.Time) (models.ChatRequest, *models.Webhook, error) {
+	prompt, err := jobs.RenderTemplate(e.Prompt, e.variables(scheduledAt))
+	if err != nil {
+		return models.ChatRequest{}, nil, err
+	}
+	var webhook *models.Webhook
+	if e.Webhook != nil {
+		hook := *e.Webhook
+		webhook = &hook
+	}
+	return models.ChatRequest{
+		Message:   prompt,
+		SessionID: e.SessionID,
+		Profile:   e.Profile,
+	}, webhook, nil
+}
+
+// context carries the owner's identity, so runs use the owner's role and
+// their jobs are visible to the owner.
+func (e *entry) context() context.Context {
+	if e.Owner == "" {
+		return context.Background()
+	}
+	return auth.WithIdentity(context.Background(), &auth.Identity{User: e.Owner, Groups: e.Groups})
+}
+
+// view returns the schedule as shown to its owner.
+func (e *entry) view() models.Schedule {
+	view := e.Schedule
+	view.History = append([]models.ScheduleRun(nil), e.History...)
+	if e.Webhook != nil {
+		hook := *e.Webhook
+		hook.Secret = ""
+		view.Webhook = &hook
+	}
+	return view
+}
+
+func lastRun(e *entry) *models.ScheduleRun {
+	if len(e.History) == 0 {
+		return nil
+	}
+	return &e.History[len(e.History)-1]
+}
+
+func (s *Scheduler) load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read schedules file: %w", err)
+	}
+
+	var entries []*entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("invalid schedules file %s: %w", s.path, err)
+	}
+	for _, e := range entries {
+		if e.Owner == "" {
+			// Left from when anonymous callers could create schedules.
+			logger.Log.WithField("scheduleID", e.ID).Warn("Dropping schedule without an owner")
+			continue
+		}
+		if err := e.compile(); err != nil {
+			logger.Log.WithError(err).WithField("scheduleID", e.ID).Warn("Skipping schedule that no longer parses")
+			continue
+		}
+		s.schedules[e.ID] = e
+	}
+	logger.Log.WithField("schedules", len(s.schedules)).Info("Loaded schedules")
+	return nil
+}
+
+// saveLocked saves the schedules, logging failures; it is used where the
+// change has already happened and can't be undone. Callers must hold s.mu.
+func (s *Scheduler) saveLocked() {
+	if err := s.save(); err != nil {
+		logger.Log.WithError(err).Error("Failed to save schedules")
+	}
+}
+
+// save writes every schedule to SCHEDULES_FILE atomically. Callers must
+// hold s.mu.
+func (s *Scheduler) save() error {
+	entries := make([]*entry, 0, len(s.schedules))
+	for _, e := range s.schedules {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create schedules directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".schedules-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
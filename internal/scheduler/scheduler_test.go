@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"claude-web-go/internal/auth"
+	"claude-web-go/internal/jobs"
+	"claude-web-go/internal/models"
+)
+
+func TestStartSettlesRunsWithoutJobs(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("JOBS_DIR", filepath.Join(dir, "jobs"))
+	t.Setenv("SCHEDULES_FILE", filepath.Join(dir, "schedules.json"))
+
+	next := time.Now().Add(time.Hour)
+	stored := []*entry{{
+		Schedule: models.Schedule{
+			ID:         "nightly",
+			Name:       "nightly",
+			Cron:       "0 3 * * *",
+			Prompt:     "Summarize {{date}}",
+			SessionID:  "session",
+			MissedRuns: models.MissedRunOnce,
+			NextRunAt:  &next,
+			CreatedAt:  time.Now().Add(-48 * time.Hour),
+			History: []models.ScheduleRun{{
+				ScheduledAt: time.Now().Add(-24 * time.Hour),
+				Trigger:     models.TriggerSchedule,
+				JobID:       "pruned-job",
+				Status:      models.JobRunning,
+			}},
+		},
+		Owner: "alice",
+	}}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "schedules.json"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager, err := jobs.NewManager(
+		func(ctx context.Context, req models.ChatRequest) models.ChatResponse { return models.ChatResponse{} },
+		func(owner string, job models.Job, webhook *models.Webhook) { s.JobFinished(job) },
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start(manager)
+
+	ctx := auth.WithIdentity(context.Background(), &auth.Identity{User: "alice"})
+	schedule, err := s.Get(ctx, "nightly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := schedule.History[0]
+	if run.Status != models.JobFailed || run.FinishedAt == nil {
+		t.Fatalf("got run %+v, want it failed", run)
+	}
+
+	// The next run is no longer skipped.
+	schedule, err = s.RunNow(ctx, "nightly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := schedule.History[len(schedule.History)-1]
+	if last.Status == models.RunSkipped || last.JobID == "" {
+		t.Fatalf("got run %+v, want it started", last)
+	}
+
+	// Let the run finish, and its outcome be saved, before the directory
+	// is removed.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		schedule, err := s.Get(ctx, "nightly")
+		if err == nil && schedule.History[len(schedule.History)-1].FinishedAt != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s did not finish", last.JobID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// WriteArchive streams a zip of the session's files to w. When names is
+// empty every stored file is included; otherwise only the named files are,
+// and an unknown name is an error reported before anything is written.
+// Entries are written one at a time, so the archive is never held in
+// memory.
+func (fm *FileManager) WriteArchive(w io.Writer, sessionID string, names []string) error {
+	files, err := fm.archiveFiles(sessionID, names)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		if err := addToArchive(archive, file); err != nil {
+			return fmt.Errorf("failed to add %s to archive: %w", file.Name, err)
+		}
+	}
+	return archive.Close()
+}
+
+// AddToArchive writes the session's files into archive, each name prefixed
+// with prefix, so several sessions can share one archive.
+func (fm *FileManager) AddToArchive(archive *zip.Writer, sessionID, prefix string) error {
+	files, err := fm.ListFiles(sessionID)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		file.Name = prefix + file.Name
+		if err := addToArchive(archive, file); err != nil {
+			return fmt.Errorf("failed to add %s to archive: %w", file.Name, err)
+		}
+	}
+	return nil
+}
+
+func (fm *FileManager) archiveFiles(sessionID string, names []string) ([]StoredFile, error) {
+	files, err := fm.ListFiles(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return files, nil
+	}
+
+	byName := make(map[string]StoredFile, len(files))
+	for _, file := range files {
+		byName[file.Name] = file
+	}
+
+	selected := make([]StoredFile, 0, len(names))
+	for _, name := range names {
+		file, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("file not found: %s", name)
+		}
+		selected = append(selected, file)
+	}
+	return selected, nil
+}
+
+func addToArchive(archive *zip.Writer, file StoredFile) error {
+	src, err := os.Open(file.Path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	header := &zip.FileHeader{
+		Name:     file.Name,
+		Method:   zip.Deflate,
+		Modified: file.StoredAt,
+	}
+	if isCompressed(file.MimeType) {
+		header.Method = zip.Store
+	}
+
+	dst, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// isCompressed reports whether deflating the type would be wasted effort.
+func isCompressed(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp", "application/zip", "application/gzip", "application/pdf":
+		return true
+	}
+	return strings.HasPrefix(mimeType, "video/") || strings.HasPrefix(mimeType, "audio/")
+}
@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxEditDistance bounds the Myers search; files this different are better
+// compared by eye than by a diff.
+const maxEditDistance = 4000
+
+const diffContext = 3
+
+type editKind byte
+
+const (
+	editEqual  editKind = ' '
+	editDelete editKind = '-'
+	editInsert editKind = '+'
+)
+
+type edit struct {
+	kind editKind
+	line string
+}
+
+// unifiedDiff renders the line diff between a and b in unified format.
+// Identical inputs produce an empty string.
+func unifiedDiff(fromName, toName string, a, b []string) (string, error) {
+	edits, err := diffLines(a, b)
+	if err != nil {
+		return "", err
+	}
+
+	changed := false
+	for _, e := range edits {
+		if e.kind != editEqual {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return "", nil
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	for start := 0; start < len(edits); {
+		// Find the next change and grow a hunk around it until the gap
+		// to the following change exceeds twice the context.
+		first := start
+		for first < len(edits) && edits[first].kind == editEqual {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+
+		hunkStart := max(first-diffContext, start)
+		hunkEnd := first
+		for i := first; i < len(edits); i++ {
+			if edits[i].kind != editEqual {
+				hunkEnd = i + 1
+			} else if i-hunkEnd >= 2*diffContext {
+				break
+			}
+		}
+		hunkEnd = min(hunkEnd+diffContext, len(edits))
+
+		writeHunk(&out, edits, hunkStart, hunkEnd)
+		start = hunkEnd
+	}
+
+	return out.String(), nil
+}
+
+func writeHunk(out *strings.Builder, edits []edit, start, end int) {
+	// Line numbers are 1-based positions in a and b of the hunk's first line.
+	aLine, bLine := 1, 1
+	for _, e := range edits[:start] {
+		if e.kind != editInsert {
+			aLine++
+		}
+		if e.kind != editDelete {
+			bLine++
+		}
+	}
+
+	aCount, bCount := 0, 0
+	for _, e := range edits[start:end] {
+		if e.kind != editInsert {
+			aCount++
+		}
+		if e.kind != editDelete {
+			bCount++
+		}
+	}
+	if aCount == 0 {
+		aLine--
+	}
+	if bCount == 0 {
+		bLine--
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+	for _, e := range edits[start:end] {
+		out.WriteByte(byte(e.kind))
+		out.WriteString(e.line)
+		if !strings.HasSuffix(e.line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// diffLines computes a shortest edit script with Myers' algorithm.
+func diffLines(a, b []string) ([]edit, error) {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+
+	// trace[d] holds the furthest x reached on diagonals -d..d before
+	// step d, which is what backtracking needs.
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= n+m && !found; d++ {
+		if d > maxEditDistance {
+			return nil, ErrTooLargeToDiff
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snapshot := trace[d]
+		at := func(k int) int { return snapshot[k+d] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := 0
+		if d > 0 {
+			prevX = at(prevK)
+		}
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			edits = append(edits, edit{editEqual, a[x-1]})
+			x--
+			y--
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			edits = append(edits, edit{editInsert, b[y-1]})
+			y--
+		} else {
+			edits = append(edits, edit{editDelete, a[x-1]})
+			x--
+		}
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits, nil
+}
@@ -1,14 +1,22 @@
 package storage
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
+
+	"claude-web-go/internal/filetype"
+	"claude-web-go/internal/logger"
+	"claude-web-go/internal/metrics"
 )
 
+// rootDir holds a directory per session.
+const rootDir = "/tmp/claude-web"
+
 type FileManager struct {
 	sessions map[string]*SessionFiles
 	mu       sync.RWMutex
@@ -18,7 +26,24 @@ type FileManager struct {
 type SessionFiles struct {
 	Dir       string
 	CreatedAt time.Time
-	Files     map[string]string
+	// ExpiresAt is when the session's files are removed: the TTL after
+	// creation, or later if a job retains them. Zero keeps them until the
+	// server stops.
+	ExpiresAt time.Time
+	Files     map[string]*StoredFile
+}
+
+// StoredFile is the index entry for a file kept in a session. Path, Size
+// and StoredAt describe the latest version.
+type StoredFile struct {
+	Name        string
+	Path        string
+	MimeType    string
+	Previewable bool
+	Language    string
+	Size        int64
+	StoredAt    time.Time
+	Versions    []FileVersion
 }
 
 func NewFileManager(ttl time.Duration) *FileManager {
@@ -27,49 +52,132 @@ func NewFileManager(ttl time.Duration) *FileManager {
 		ttl:      ttl,
 	}
 	
+	metrics.WatchFileStore(fm.Usage)
 	go fm.cleanup()
 	return fm
 }
 
-func (fm *FileManager) StoreFile(sessionID, originalPath, filename string) error {
-	fm.mu.Lock()
-	defer fm.mu.Unlock()
+// Usage returns the number of sessions with files and the bytes their
+// versions take up. Identical content shared by several names in a
+// session is counted once.
+func (fm *FileManager) Usage() (sessions int, bytes int64) {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
 
-	session, exists := fm.sessions[sessionID]
-	if !exists {
-		sessionDir := filepath.Join("/tmp", "claude-web", sessionID)
-		if err := os.MkdirAll(sessionDir, 0755); err != nil {
-			return err
-		}
-		
-		session = &SessionFiles{
-			Dir:       sessionDir,
-			CreatedAt: time.Now(),
-			Files:     make(map[string]string),
+	for _, session := range fm.sessions {
+		seen := make(map[string]bool)
+		for _, file := range session.Files {
+			for _, version := range file.Versions {
+				if !seen[version.Hash] {
+					seen[version.Hash] = true
+					bytes += version.Size
+				}
+			}
 		}
-		fm.sessions[sessionID] = session
 	}
+	return len(fm.sessions), bytes
+}
 
-	destPath := filepath.Join(session.Dir, filename)
-	
-	src, err := os.Open(originalPath)
+// CheckWritable reports whether new files can be stored.
+func (fm *FileManager) CheckWritable() error {
+	if err := os.MkdirAll(rootDir, 0755); err != nil {
+		return fmt.Errorf("file store is not writable: %w", err)
+	}
+	f, err := os.CreateTemp(rootDir, ".ready-*")
 	if err != nil {
-		return err
+		return fmt.Errorf("file store is not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// StoreFile adds the file at originalPath to the session under filename.
+// Every distinct content becomes a new immutable version; storing content
+// identical to the latest version returns that version unchanged.
+func (fm *FileManager) StoreFile(ctx context.Context, sessionID, originalPath, filename string) (FileVersion, error) {
+	// Filenames are slash-separated paths relative to the session, and
+	// must stay inside it.
+	if !filepath.IsLocal(filepath.FromSlash(filename)) {
+		return FileVersion{}, fmt.Errorf("invalid filename %q", filename)
+	}
+
+	session, err := fm.session(sessionID)
+	if err != nil {
+		return FileVersion{}, err
 	}
-	defer src.Close()
 
-	dst, err := os.Create(destPath)
+	// Decide on content rather than the name, so an extensionless SVG
+	// doesn't slip through unsanitized.
+	fileType, err := filetype.DetectFile(originalPath)
 	if err != nil {
-		return err
+		return FileVersion{}, err
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, src); err != nil {
-		return err
+	// Copying and thumbnailing happen outside the lock; objects are
+	// content-addressed, so concurrent writers can't clobber each other.
+	version, err := writeObject(filepath.Join(session.Dir, objectsDir), originalPath, fileType.MimeType == "image/svg+xml")
+	if err != nil {
+		return FileVersion{}, err
 	}
+	version.MimeType = fileType.MimeType
+	version.Text = fileType.Text
+	log := logger.FromContext(ctx).WithFields(map[string]interface{}{
+		"sessionID": sessionID,
+		"filename":  filename,
+	})
+	version.Renditions = generateRenditions(log, version)
 
-	session.Files[filename] = destPath
-	return nil
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	file, exists := session.Files[filename]
+	if !exists {
+		file = &StoredFile{Name: filename}
+		session.Files[filename] = file
+	}
+	if latest, ok := file.latest(); ok && latest.Hash == version.Hash {
+		return latest, nil
+	}
+
+	log.WithFields(map[string]interface{}{
+		"version": version.ID,
+		"size":    version.Size,
+	}).Debug("Stored new file version")
+	file.Versions = append(file.Versions, version)
+	file.Path = version.Path
+	file.MimeType = fileType.MimeType
+	file.Previewable = fileType.Previewable
+	file.Language = fileType.Language
+	file.Size = version.Size
+	file.StoredAt = version.StoredAt
+	return version, nil
+}
+
+// session returns the index for sessionID, creating it and its directory
+// on first use.
+func (fm *FileManager) session(sessionID string) (*SessionFiles, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	session, exists := fm.sessions[sessionID]
+	if exists {
+		return session, nil
+	}
+
+	sessionDir := filepath.Join(rootDir, sessionID)
+	if err := os.MkdirAll(filepath.Join(sessionDir, objectsDir), 0755); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session = &SessionFiles{
+		Dir:       sessionDir,
+		CreatedAt: now,
+		ExpiresAt: now.Add(fm.ttl),
+		Files:     make(map[string]*StoredFile),
+	}
+	fm.sessions[sessionID] = session
+	return session, nil
 }
 
 func (fm *FileManager) GetFile(sessionID, filename string) (string, error) {
@@ -81,16 +189,59 @@ func (fm *FileManager) GetFile(sessionID, filename string) (string, error) {
 		return "", fmt.Errorf("session not found")
 	}
 
-	path, exists := session.Files[filename]
+	file, exists := session.Files[filename]
 	if !exists {
 		return "", fmt.Errorf("file not found")
 	}
 
-	return path, nil
+	return file.Path, nil
+}
+
+// ListFiles returns the index entries for every file stored in a session,
+// sorted by name.
+func (fm *FileManager) ListFiles(sessionID string) ([]StoredFile, error) {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	session, exists := fm.sessions[sessionID]
+	if !exists {
+		return nil, fmt.Errorf("session not found")
+	}
+
+	files := make([]StoredFile, 0, len(session.Files))
+	for _, file := range session.Files {
+		copied := *file
+		copied.Versions = append([]FileVersion(nil), file.Versions...)
+		files = append(files, copied)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	return files, nil
 }
 
+// Retain keeps a session's files for at least d from now, or until the
+// server stops when d is zero, so that jobs kept longer than the TTL can
+// still serve them. Sessions without files are left alone.
+func (fm *FileManager) Retain(sessionID string, d time.Duration) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	session, exists := fm.sessions[sessionID]
+	if !exists || session.ExpiresAt.IsZero() {
+		return
+	}
+	if d == 0 {
+		session.ExpiresAt = time.Time{}
+	} else if until := time.Now().Add(d); until.After(session.ExpiresAt) {
+		session.ExpiresAt = until
+	}
+}
+
+// cleanup removes expired sessions, checking at least as often as the TTL.
 func (fm *FileManager) cleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
+	ticker := time.NewTicker(min(fm.ttl, 5*time.Minute))
 	defer ticker.Stop()
 
 	for range ticker.C {
@@ -98,11 +249,11 @@ func (fm *FileManager) cleanup() {
 		now := time.Now()
 		
 		for sessionID, session := range fm.sessions {
-			if now.Sub(session.CreatedAt) > fm.ttl {
+			if !session.ExpiresAt.IsZero() && now.After(session.ExpiresAt) {
 				os.RemoveAll(session.Dir)
 				delete(fm.sessions, sessionID)
 			}
 		}
 		fm.mu.Unlock()
 	}
-}
\ No newline at end of file
+}
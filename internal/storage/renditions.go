@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Rendition names accepted by GetRendition.
+const (
+	RenditionThumb  = "thumb"
+	RenditionMedium = "medium"
+	// RenditionPNG is the full-size bitmap fallback for an SVG.
+	RenditionPNG = "png"
+)
+
+// renditionWidths is the bounding box, in pixels, of each scaled rendition.
+var renditionWidths = map[string]int{
+	RenditionThumb:  256,
+	RenditionMedium: 1024,
+}
+
+const (
+	// maxRasterPixels guards against decompression bombs.
+	maxRasterPixels = 50_000_000
+	// maxSVGRasterSize caps the longer side of a rasterized SVG.
+	maxSVGRasterSize = 2048
+	svgRasterTimeout = 20 * time.Second
+)
+
+// generateRenditions creates the scaled and rasterized variants of a
+// version next to its object. Images already smaller than a rendition are
+// served as-is for that size, so not every name is always present.
+func generateRenditions(log *logrus.Entry, version FileVersion) map[string]string {
+	var source image.Image
+	var err error
+
+	renditions := make(map[string]string)
+
+	switch version.MimeType {
+	case "image/svg+xml":
+		pngPath := version.Path + "." + RenditionPNG + ".png"
+		if exists(pngPath) {
+			// Identical content was already rasterized.
+		} else if err = rasterizeSVG(log, version.Path, pngPath); err != nil {
+			log.WithError(err).WithField("object", version.Hash).Warn("Failed to rasterize SVG")
+			return nil
+		}
+		renditions[RenditionPNG] = pngPath
+		source, err = decodeImage(pngPath)
+	default:
+		if !isRasterImage(version.MimeType) {
+			return nil
+		}
+		source, err = decodeImage(version.Path)
+	}
+	if err != nil {
+		log.WithError(err).WithField("object", version.Hash).Warn("Failed to decode image for thumbnails")
+		return renditions
+	}
+
+	for name, width := range renditionWidths {
+		bounds := source.Bounds()
+		if bounds.Dx() <= width && bounds.Dy() <= width {
+			continue
+		}
+
+		path, err := writeScaled(version, source, name, width)
+		if err != nil {
+			log.WithError(err).WithField("object", version.Hash).WithField("rendition", name).Warn("Failed to create thumbnail")
+			continue
+		}
+		renditions[name] = path
+	}
+
+	return renditions
+}
+
+func decodeImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxRasterPixels {
+		return nil, fmt.Errorf("image too large: %dx%d", config.Width, config.Height)
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// writeScaled stores source scaled to fit within a width x width box.
+// JPEG sources stay JPEG; everything else becomes PNG to keep transparency.
+func writeScaled(version FileVersion, source image.Image, name string, width int) (string, error) {
+	ext := ".png"
+	if version.MimeType == "image/jpeg" {
+		ext = ".jpg"
+	}
+	path := version.Path + "." + name + ext
+	if exists(path) {
+		return path, nil
+	}
+
+	bounds := source.Bounds()
+	scale := math.Min(float64(width)/float64(bounds.Dx()), float64(width)/float64(bounds.Dy()))
+	target := image.Rect(0, 0, max(1, int(float64(bounds.Dx())*scale)), max(1, int(float64(bounds.Dy())*scale)))
+
+	scaled := image.NewRGBA(target)
+	xdraw.CatmullRom.Scale(scaled, target, source, bounds, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if ext == ".jpg" {
+		if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85}); err != nil {
+			return "", err
+		}
+	} else if err := png.Encode(&buf, scaled); err != nil {
+		return "", err
+	}
+
+	return path, os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// rasterizeSVG renders an SVG to PNG. rsvg-convert is preferred when it is
+// installed because it renders text; the pure-Go renderer is the fallback
+// and draws shapes only.
+func rasterizeSVG(log *logrus.Entry, svgPath, pngPath string) error {
+	f, err := os.Open(svgPath)
+	if err != nil {
+		return err
+	}
+	icon, err := oksvg.ReadIconStream(f, oksvg.IgnoreErrorMode)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to parse SVG: %w", err)
+	}
+
+	width, height := rasterSize(icon.ViewBox.W, icon.ViewBox.H)
+
+	if rsvg, err := exec.LookPath("rsvg-convert"); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), svgRasterTimeout)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, rsvg,
+			"--format", "png",
+			"--width", fmt.Sprint(width),
+			"--height", fmt.Sprint(height),
+			"--output", pngPath,
+			svgPath,
+		)
+		output, err := cmd.CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		log.WithError(err).WithField("output", string(output)).Warn("rsvg-convert failed, falling back to built-in rasterizer")
+	}
+
+	icon.SetTarget(0, 0, float64(width), float64(height))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	scanner := rasterx.NewScannerGV(width, height, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(width, height, scanner), 1)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	return os.WriteFile(pngPath, buf.Bytes(), 0644)
+}
+
+// rasterSize picks pixel dimensions for an SVG viewBox, capping the longer
+// side at maxSVGRasterSize.
+func rasterSize(w, h float64) (int, int) {
+	if w <= 0 || h <= 0 {
+		return 512, 512
+	}
+	if longest := math.Max(w, h); longest > maxSVGRasterSize {
+		w, h = w*maxSVGRasterSize/longest, h*maxSVGRasterSize/longest
+	}
+	return max(1, int(math.Round(w))), max(1, int(math.Round(h)))
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func isRasterImage(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// renditionMimeType reports the content type of a rendition of a version.
+func renditionMimeType(version FileVersion, name string) string {
+	if name != RenditionPNG && version.MimeType == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// GetRendition returns the path and content type of a scaled or rasterized
+// variant of a file version; an empty versionID means the latest. When an
+// image is already smaller than the requested size, the original is
+// returned.
+func (fm *FileManager) GetRendition(sessionID, filename, versionID, name string) (string, string, error) {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	file, err := fm.lookup(sessionID, filename)
+	if err != nil {
+		return "", "", err
+	}
+
+	version, ok := file.latest()
+	if versionID != "" {
+		version, ok = file.version(versionID)
+	}
+	if !ok {
+		return "", "", fmt.Errorf("version %w", ErrNotFound)
+	}
+
+	if path, ok := version.Renditions[name]; ok {
+		return path, renditionMimeType(version, name), nil
+	}
+
+	_, scaled := renditionWidths[name]
+	if scaled && isRasterImage(version.MimeType) {
+		return version.Path, version.MimeType, nil
+	}
+	if scaled && version.MimeType == "image/svg+xml" {
+		if path, ok := version.Renditions[RenditionPNG]; ok {
+			return path, "image/png", nil
+		}
+	}
+
+	return "", "", fmt.Errorf("rendition %s %w", name, ErrNotFound)
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Elements that can execute script or pull in foreign content. They are
+// dropped together with everything nested inside them.
+var blockedSVGElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+	"iframe":        true,
+	"embed":         true,
+	"object":        true,
+	"handler":       true,
+	"listener":      true,
+}
+
+// Animation elements can rewrite attributes after load, e.g. turning a
+// harmless href into a javascript: URL.
+var animationSVGElements = map[string]bool{
+	"set":              true,
+	"animate":          true,
+	"animatetransform": true,
+	"animatemotion":    true,
+}
+
+var (
+	cssImportPattern     = regexp.MustCompile(`(?i)@import[^;]*;?`)
+	cssExpressionPattern = regexp.MustCompile(`(?i)expression\s*\(`)
+	cssURLPattern        = regexp.MustCompile(`(?i)url\(\s*['"]?\s*([^'")]*?)\s*['"]?\s*\)`)
+	safeDataImagePattern = regexp.MustCompile(`(?i)^data:image/(png|jpeg|gif|webp);base64,`)
+)
+
+// SanitizeSVG removes scripts, event handlers and references to external
+// resources from an SVG document. Only same-document references (#id) and
+// inline raster data URIs survive.
+func SanitizeSVG(data []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Entity = xml.HTMLEntity
+
+	var out bytes.Buffer
+	skipDepth := 0
+	inStyle := false
+
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SVG: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if skipDepth > 0 {
+				skipDepth++
+				continue
+			}
+			if isBlockedSVGElement(t) {
+				skipDepth = 1
+				continue
+			}
+			inStyle = strings.EqualFold(t.Name.Local, "style")
+			out.WriteString("<" + qualifiedName(t.Name))
+			for _, attr := range t.Attr {
+				value, ok := sanitizeSVGAttr(attr)
+				if !ok {
+					continue
+				}
+				out.WriteString(" " + qualifiedName(attr.Name) + `="`)
+				xml.EscapeText(&out, []byte(value))
+				out.WriteString(`"`)
+			}
+			out.WriteString(">")
+		case xml.EndElement:
+			if skipDepth > 0 {
+				skipDepth--
+				continue
+			}
+			inStyle = false
+			out.WriteString("</" + qualifiedName(t.Name) + ">")
+		case xml.CharData:
+			if skipDepth > 0 {
+				continue
+			}
+			text := string(t)
+			if inStyle {
+				text = sanitizeCSS(text)
+			}
+			xml.EscapeText(&out, []byte(text))
+		case xml.ProcInst:
+			if skipDepth > 0 || t.Target != "xml" {
+				continue
+			}
+			out.WriteString("<?xml " + string(t.Inst) + "?>")
+		case xml.Comment, xml.Directive:
+			// Comments are noise and DOCTYPE/ENTITY declarations are an
+			// injection vector, so neither is carried over.
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+func isBlockedSVGElement(el xml.StartElement) bool {
+	local := strings.ToLower(el.Name.Local)
+	if blockedSVGElements[local] {
+		return true
+	}
+	if animationSVGElements[local] {
+		for _, attr := range el.Attr {
+			if strings.ToLower(attr.Name.Local) != "attributename" {
+				continue
+			}
+			target := strings.ToLower(strings.TrimSpace(attr.Value))
+			if strings.HasSuffix(target, "href") || strings.HasPrefix(target, "on") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func sanitizeSVGAttr(attr xml.Attr) (string, bool) {
+	local := strings.ToLower(attr.Name.Local)
+	value := attr.Value
+
+	if strings.HasPrefix(local, "on") {
+		return "", false
+	}
+
+	compact := strings.ToLower(strings.Join(strings.Fields(value), ""))
+	if strings.Contains(compact, "javascript:") || strings.Contains(compact, "vbscript:") {
+		return "", false
+	}
+
+	switch local {
+	case "href", "src":
+		if !isSafeReference(value) {
+			return "", false
+		}
+		return value, true
+	case "style":
+		return sanitizeCSS(value), true
+	}
+
+	// Presentation attributes such as fill="url(...)" may point elsewhere.
+	if strings.Contains(compact, "url(") {
+		sanitized := sanitizeCSS(value)
+		if sanitized != value {
+			return "", false
+		}
+	}
+
+	return value, true
+}
+
+func sanitizeCSS(css string) string {
+	if !strings.Contains(css, "(") && !strings.Contains(css, "@") {
+		return css
+	}
+	css = cssImportPattern.ReplaceAllString(css, "")
+	css = cssExpressionPattern.ReplaceAllString(css, "(")
+	return cssURLPattern.ReplaceAllStringFunc(css, func(match string) string {
+		target := cssURLPattern.FindStringSubmatch(match)[1]
+		if isSafeReference(target) {
+			return match
+		}
+		return "none"
+	})
+}
+
+func isSafeReference(ref string) bool {
+	ref = strings.TrimSpace(ref)
+	return strings.HasPrefix(ref, "#") || safeDataImagePattern.MatchString(ref)
+}
+
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
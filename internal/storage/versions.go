@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// objectsDir holds a session's content-addressed file contents, named by
+// their SHA-256.
+const objectsDir = ".objects"
+
+// versionIDLength is how many hex characters of the hash identify a
+// version in URLs.
+const versionIDLength = 16
+
+// maxDiffSize bounds each side of a diff, since the diff is computed in
+// memory.
+const maxDiffSize = 1 << 20
+
+var (
+	ErrNotFound       = errors.New("not found")
+	ErrNotText        = errors.New("file is not a text file")
+	ErrTooLargeToDiff = errors.New("file too large to diff")
+	ErrNoEarlier      = errors.New("no earlier version to compare with")
+)
+
+// FileVersion is one immutable revision of a stored file.
+type FileVersion struct {
+	ID       string
+	Hash     string
+	Path     string
+	MimeType string
+	Text     bool
+	Size     int64
+	StoredAt time.Time
+	// Renditions maps rendition names to thumbnails and bitmap fallbacks
+	// stored next to the object.
+	Renditions map[string]string
+}
+
+func (f *StoredFile) latest() (FileVersion, bool) {
+	if len(f.Versions) == 0 {
+		return FileVersion{}, false
+	}
+	return f.Versions[len(f.Versions)-1], true
+}
+
+func (f *StoredFile) version(id string) (FileVersion, bool) {
+	for _, version := range f.Versions {
+		if version.ID == id {
+			return version, true
+		}
+	}
+	return FileVersion{}, false
+}
+
+// writeObject copies originalPath into dir under the hash of its content,
+// sanitizing it first when it is an SVG. Identical content shares a single
+// object.
+func writeObject(dir, originalPath string, sanitizeSVG bool) (FileVersion, error) {
+	tmp, err := os.CreateTemp(dir, "incoming-*")
+	if err != nil {
+		return FileVersion{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	dst := io.MultiWriter(tmp, hash)
+
+	if sanitizeSVG {
+		err = copySanitizedSVG(dst, originalPath)
+	} else {
+		err = copyFrom(dst, originalPath)
+	}
+	if err != nil {
+		tmp.Close()
+		return FileVersion{}, err
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return FileVersion{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return FileVersion{}, err
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	objectPath := filepath.Join(dir, sum)
+	if err := os.Rename(tmp.Name(), objectPath); err != nil {
+		return FileVersion{}, err
+	}
+
+	return FileVersion{
+		ID:       sum[:versionIDLength],
+		Hash:     sum,
+		Path:     objectPath,
+		Size:     info.Size(),
+		StoredAt: time.Now(),
+	}, nil
+}
+
+func copyFrom(dst io.Writer, originalPath string) error {
+	src, err := os.Open(originalPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// copySanitizedSVG copies an SVG with active content stripped, since the
+// file is later served inline from our own origin.
+func copySanitizedSVG(dst io.Writer, originalPath string) error {
+	data, err := os.ReadFile(originalPath)
+	if err != nil {
+		return err
+	}
+
+	sanitized, err := SanitizeSVG(data)
+	if err != nil {
+		return fmt.Errorf("refusing to store unsanitizable SVG: %w", err)
+	}
+
+	_, err = dst.Write(sanitized)
+	return err
+}
+
+// ListVersions returns every version of a file, oldest first.
+func (fm *FileManager) ListVersions(sessionID, filename string) ([]FileVersion, error) {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	file, err := fm.lookup(sessionID, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]FileVersion(nil), file.Versions...), nil
+}
+
+// GetFileVersion returns the path of a specific version of a file.
+func (fm *FileManager) GetFileVersion(sessionID, filename, versionID string) (string, error) {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	file, err := fm.lookup(sessionID, filename)
+	if err != nil {
+		return "", err
+	}
+
+	version, ok := file.version(versionID)
+	if !ok {
+		return "", fmt.Errorf("version %w", ErrNotFound)
+	}
+
+	return version.Path, nil
+}
+
+// Diff returns a unified diff between two versions of a text file. An empty
+// fromID means the version before toID, and an empty toID means the latest.
+func (fm *FileManager) Diff(sessionID, filename, fromID, toID string) (string, error) {
+	from, to, err := fm.diffVersions(sessionID, filename, fromID, toID)
+	if err != nil {
+		return "", err
+	}
+
+	if !from.Text || !to.Text {
+		return "", ErrNotText
+	}
+	if from.Size > maxDiffSize || to.Size > maxDiffSize {
+		return "", ErrTooLargeToDiff
+	}
+
+	a, err := os.ReadFile(from.Path)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(to.Path)
+	if err != nil {
+		return "", err
+	}
+
+	return unifiedDiff(
+		filename+"@"+from.ID, filename+"@"+to.ID,
+		splitLines(string(a)), splitLines(string(b)),
+	)
+}
+
+func (fm *FileManager) diffVersions(sessionID, filename, fromID, toID string) (FileVersion, FileVersion, error) {
+	fm.mu.RLock()
+	defer fm.mu.RUnlock()
+
+	file, err := fm.lookup(sessionID, filename)
+	if err != nil {
+		return FileVersion{}, FileVersion{}, err
+	}
+
+	toIndex := len(file.Versions) - 1
+	if toID != "" {
+		toIndex = -1
+		for i, version := range file.Versions {
+			if version.ID == toID {
+				toIndex = i
+			}
+		}
+		if toIndex < 0 {
+			return FileVersion{}, FileVersion{}, fmt.Errorf("version %s %w", toID, ErrNotFound)
+		}
+	}
+
+	if fromID == "" {
+		if toIndex < 1 {
+			return FileVersion{}, FileVersion{}, ErrNoEarlier
+		}
+		return file.Versions[toIndex-1], file.Versions[toIndex], nil
+	}
+
+	from, ok := file.version(fromID)
+	if !ok {
+		return FileVersion{}, FileVersion{}, fmt.Errorf("version %s %w", fromID, ErrNotFound)
+	}
+	return from, file.Versions[toIndex], nil
+}
+
+// lookup must be called with fm.mu held.
+func (fm *FileManager) lookup(sessionID, filename string) (*StoredFile, error) {
+	session, exists := fm.sessions[sessionID]
+	if !exists {
+		return nil, fmt.Errorf("session %w", ErrNotFound)
+	}
+
+	file, exists := session.Files[filename]
+	if !exists {
+		return nil, fmt.Errorf("file %w", ErrNotFound)
+	}
+
+	return file, nil
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,89 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are exported over
+// OTLP/HTTP when an endpoint is configured through the standard
+// OTEL_EXPORTER_OTLP_* variables; otherwise they are still created, so
+// responses and logs carry trace IDs, but not exported.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"claude-web-go/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "claude-web-go"
+
+// Tracer returns the tracer for an instrumented package.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer("claude-web-go/internal/" + name)
+}
+
+// Setup installs the global tracer provider and the W3C trace context
+// propagator. The returned function flushes and stops the exporter.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the default
+	// service name.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	// The sampler follows OTEL_TRACES_SAMPLER, sampling everything by
+	// default.
+	options := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint != "" {
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+		logger.Log.WithField("endpoint", endpoint).Info("Exporting traces over OTLP")
+	} else {
+		logger.Log.Info("No OTLP endpoint configured; traces are not exported")
+	}
+
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	return provider.Shutdown, nil
+}
+
+// TraceID returns the ID of the trace ctx belongs to, or "" outside a
+// trace.
+func TraceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+// End records err, if any, on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
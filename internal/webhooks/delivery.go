@@ -0,0 +1,246 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"claude-web-go/internal/auth"
+	"claude-web-go/internal/logger"
+	"claude-web-go/internal/models"
+	"github.com/google/uuid"
+)
+
+// maxDeliveries is how many log entries are kept per webhook.
+const maxDeliveries = 100
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256,
+// keyed with the webhook's secret, of the timestamp, a dot and the body.
+const (
+	headerID        = "X-Webhook-ID"
+	headerEvent     = "X-Webhook-Event"
+	headerTimestamp = "X-Webhook-Timestamp"
+	headerSignature = "X-Webhook-Signature"
+)
+
+// deliveryLog holds a webhook's most recent deliveries, oldest first.
+type deliveryLog struct {
+	owner   string
+	entries []*models.WebhookDelivery
+}
+
+// Deliveries returns the delivery log of one of the caller's webhooks,
+// newest first. Job webhooks have a log once their first event is sent.
+func (d *Dispatcher) Deliveries(ctx context.Context, id string) ([]models.WebhookDelivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	log, ok := d.logs[id]
+	if !ok {
+		if sub, ok := d.subs[id]; ok && sub.Owner == auth.UserFromContext(ctx) {
+			return []models.WebhookDelivery{}, nil
+		}
+		return nil, ErrNotFound
+	}
+	if log.owner != auth.UserFromContext(ctx) {
+		return nil, ErrNotFound
+	}
+
+	deliveries := make([]models.WebhookDelivery, 0, len(log.entries))
+	for i := len(log.entries) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, *log.entries[i])
+	}
+	return deliveries, nil
+}
+
+// Test sends a sample event to one of the caller's webhooks and waits for
+// the single attempt to finish, so the result can be shown at once.
+func (d *Dispatcher) Test(ctx context.Context, id string) (models.WebhookDelivery, error) {
+	d.mu.Lock()
+	sub, ok := d.subs[id]
+	if !ok || sub.Owner != auth.UserFromContext(ctx) {
+		d.mu.Unlock()
+		return models.WebhookDelivery{}, ErrNotFound
+	}
+	hook := sub.Webhook
+	d.mu.Unlock()
+
+	event := models.WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      models.EventTest,
+		CreatedAt: time.Now(),
+		Data:      map[string]string{"message": "This is a test event."},
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	delivery := d.startDelivery(sub.Owner, hook, event)
+	status, err := d.send(ctx, hook, event, body)
+	return d.finishAttempt(delivery, status, err, true), nil
+}
+
+// deliver sends an event to a webhook, retrying network errors, 429s and
+// 5xx responses with jittered exponential backoff.
+func (d *Dispatcher) deliver(owner string, hook models.Webhook, event models.WebhookEvent, body []byte) {
+	log := logger.Log.WithFields(map[string]interface{}{
+		"webhookID": hook.ID,
+		"event":     event.Type,
+		"eventID":   event.ID,
+	})
+	delivery := d.startDelivery(owner, hook, event)
+
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-d.closing:
+				d.abandon(delivery, "The server shut down before the delivery was retried.")
+				log.Warn("Abandoning webhook delivery at shutdown")
+				return
+			case <-time.After(d.delay(attempt - 1)):
+			}
+		}
+
+		status, err := d.send(d.ctx, hook, event, body)
+		final := err == nil || !retryable(status) || attempt == d.maxAttempts
+		result := d.finishAttempt(delivery, status, err, final)
+		if err == nil {
+			log.WithField("attempts", attempt).Debug("Webhook delivered")
+			return
+		}
+		log.WithError(err).WithField("attempt", attempt).Warn("Webhook delivery failed")
+		if final {
+			log.WithField("attempts", result.Attempts).Error("Giving up on webhook delivery")
+			return
+		}
+	}
+}
+
+// send makes one delivery attempt. It returns the response status, if any,
+// and an error unless the webhook answered with a 2xx.
+func (d *Dispatcher) send(ctx context.Context, hook models.Webhook, event models.WebhookEvent, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	// Webhooks saved before https was required are held to it too.
+	if err := allowedDestinations().checkScheme(req.URL); err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "claude-web-webhooks")
+	req.Header.Set(headerID, event.ID)
+	req.Header.Set(headerEvent, event.Type)
+	req.Header.Set(headerTimestamp, timestamp)
+	req.Header.Set(headerSignature, "sha256="+sign(hook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryable reports whether a failed attempt is worth repeating: the
+// request never got a response, or the receiver was overloaded or broken.
+func retryable(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// delay returns a random wait of up to baseDelay doubled per retry, capped
+// at maxDelay.
+func (d *Dispatcher) delay(retry int) time.Duration {
+	ceiling := d.maxDelay
+	if shift := retry - 1; shift < 20 && d.baseDelay<<shift < ceiling {
+		ceiling = d.baseDelay << shift
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling) + 1
+}
+
+// startDelivery adds a pending entry to the webhook's delivery log.
+func (d *Dispatcher) startDelivery(owner string, hook models.Webhook, event models.WebhookEvent) *models.WebhookDelivery {
+	now := time.Now()
+	delivery := &models.WebhookDelivery{
+		ID:        uuid.New().String(),
+		WebhookID: hook.ID,
+		EventID:   event.ID,
+		Event:     event.Type,
+		Status:    models.DeliveryPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	log, ok := d.logs[hook.ID]
+	if !ok {
+		log = &deliveryLog{owner: owner}
+		d.logs[hook.ID] = log
+	}
+	log.entries = append(log.entries, delivery)
+	if len(log.entries) > maxDeliveries {
+		log.entries = log.entries[len(log.entries)-maxDeliveries:]
+	}
+	return delivery
+}
+
+// abandon fails a delivery that won't be attempted again.
+func (d *Dispatcher) abandon(delivery *models.WebhookDelivery, reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delivery.Status = models.DeliveryFailed
+	delivery.Error = reason
+	delivery.UpdatedAt = time.Now()
+}
+
+// finishAttempt records an attempt's outcome and returns a copy of the
+// updated entry. The delivery fails if the attempt failed and was final.
+func (d *Dispatcher) finishAttempt(delivery *models.WebhookDelivery, status int, err error, final bool) models.WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	delivery.UpdatedAt = time.Now()
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryDelivered
+		delivery.Error = ""
+	case final:
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = err.Error()
+	default:
+		delivery.Error = err.Error()
+	}
+	return *delivery
+}
@@ -0,0 +1,173 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"claude-web-go/internal/logger"
+)
+
+// resolveTimeout bounds the DNS lookup of a new webhook's host.
+const resolveTimeout = 5 * time.Second
+
+// sharedAddressSpace is the carrier-grade NAT range, which some clouds use
+// for their metadata services.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// allowedDestinations is read from the environment once.
+var allowedDestinations = sync.OnceValue(destinationsFromEnv)
+
+// destinations decides where webhooks may be delivered. Deliveries must
+// use https and reach a public address, so callers can't make the server
+// probe its own network. Hosts and networks in WEBHOOK_ALLOWED_HOSTS are
+// exempt from both rules, for receivers inside the deployment.
+type destinations struct {
+	hosts    map[string]bool
+	networks []*net.IPNet
+}
+
+// destinationsFromEnv reads WEBHOOK_ALLOWED_HOSTS, a comma-separated list
+// of host names, IP addresses and CIDR networks.
+func destinationsFromEnv() destinations {
+	d := destinations{hosts: make(map[string]bool)}
+	for _, entry := range strings.Split(os.Getenv("WEBHOOK_ALLOWED_HOSTS"), ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case strings.Contains(entry, "/"):
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				logger.Log.WithField("entry", entry).Warn("Ignoring invalid network in WEBHOOK_ALLOWED_HOSTS")
+				continue
+			}
+			d.networks = append(d.networks, network)
+		default:
+			if ip := net.ParseIP(entry); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				d.networks = append(d.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+			d.hosts[entry] = true
+		}
+	}
+	return d
+}
+
+// allowedHost reports whether host, a name or IP literal, is listed in
+// WEBHOOK_ALLOWED_HOSTS.
+func (d destinations) allowedHost(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return d.listed(ip)
+	}
+	return d.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]
+}
+
+func (d destinations) listed(ip net.IP) bool {
+	for _, network := range d.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedIP reports whether a webhook may connect to ip.
+func (d destinations) allowedIP(ip net.IP) bool {
+	if d.listed(ip) {
+		return true
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip))
+}
+
+// checkScheme requires https unless the URL's host is allowed.
+func (d destinations) checkScheme(u *url.URL) error {
+	if u.Scheme != "https" && !d.allowedHost(u.Hostname()) {
+		return errors.New("webhook url must use https")
+	}
+	return nil
+}
+
+// checkURL vets a webhook URL given by a caller: its scheme, and every
+// address its host resolves to.
+func (d destinations) checkURL(ctx context.Context, u *url.URL) error {
+	if err := d.checkScheme(u); err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if d.allowedHost(host) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("webhook host %s could not be resolved", host)
+	}
+	for _, addr := range addrs {
+		if !d.allowedIP(addr.IP) {
+			return fmt.Errorf("webhook host %s resolves to a private or local address", host)
+		}
+	}
+	return nil
+}
+
+// client returns an HTTP client that checks every address it connects to
+// when dialing, so a host that resolves differently after the webhook was
+// created still can't reach the local network. Proxies in the environment
+// are ignored. Redirects aren't followed, so they can't lead to a plain
+// http URL; a 3xx fails the delivery.
+func (d destinations) client(timeout time.Duration) *http.Client {
+	guarded := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !d.allowedIP(ip) {
+				return fmt.Errorf("webhook address %s is not allowed", host)
+			}
+			return nil
+		},
+	}
+	direct := &net.Dialer{Timeout: 30 * time.Second}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would dial the target itself, past the guard, so deliveries
+	// always connect directly.
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if d.allowedHost(host) {
+			return direct.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,40 @@
+package webhooks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientIgnoresProxyEnvironment(t *testing.T) {
+	var proxied atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+	t.Setenv("HTTPS_PROXY", proxy.URL)
+	t.Setenv("HTTP_PROXY", proxy.URL)
+
+	// The proxy itself may be reached, as an operator would list it.
+	proxyURL, err := url.Parse(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WEBHOOK_ALLOWED_HOSTS", proxyURL.Hostname())
+	client := destinationsFromEnv().client(5 * time.Second)
+
+	for _, target := range []string{"https://10.0.0.1/hook", "http://169.254.169.254/latest/meta-data/"} {
+		resp, err := client.Post(target, "application/json", nil)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("POST %s succeeded with status %d, want it refused", target, resp.StatusCode)
+		}
+	}
+	if n := proxied.Load(); n != 0 {
+		t.Errorf("proxy got %d requests, want none", n)
+	}
+}
@@ -0,0 +1,343 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"claude-web-go/internal/auth"
+	"claude-web-go/internal/config"
+	"claude-web-go/internal/logger"
+	"claude-web-go/internal/models"
+	"github.com/google/uuid"
+)
+
+const defaultFile = "/tmp/claude-web-webhooks.json"
+
+var ErrNotFound = errors.New("webhook not found")
+
+// ErrAnonymous is returned when a caller without an identity tries to
+// subscribe. Every anonymous caller would share the same empty owner and
+// so receive each other's events.
+var ErrAnonymous = errors.New("webhook subscriptions require an authenticated user")
+
+// events are the event types a webhook can subscribe to.
+var events = []string{
+	models.EventJobCompleted,
+	models.EventJobFailed,
+	models.EventJobCancelled,
+	models.EventMessageCompleted,
+	models.EventMessageFailed,
+	models.EventFileCreated,
+}
+
+// subscription is a webhook as kept in WEBHOOKS_FILE.
+type subscription struct {
+	models.Webhook
+	// Owner is the user whose events the webhook receives.
+	Owner string `json:"owner"`
+}
+
+// Dispatcher signs and delivers events to the webhooks subscribed to them,
+// retrying failed deliveries with backoff. Per-user subscriptions are kept
+// in WEBHOOKS_FILE; the delivery log is kept in memory.
+type Dispatcher struct {
+	client      *http.Client
+	path        string
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+
+	// closing stops retries once Shutdown has been called; ctx, cancelled
+	// when Shutdown gives up, aborts attempts under way. deliveries tracks
+	// the deliveries in the background, pending those not yet over.
+	closing    chan struct{}
+	ctx        context.Context
+	cancel     context.CancelFunc
+	deliveries sync.WaitGroup
+	pending    atomic.Int32
+
+	mu   sync.Mutex
+	subs map[string]*subscription
+	logs map[string]*deliveryLog
+}
+
+func NewDispatcher() (*Dispatcher, error) {
+	path := os.Getenv("WEBHOOKS_FILE")
+	if path == "" {
+		path = defaultFile
+	}
+
+	d := &Dispatcher{
+		client:      allowedDestinations().client(config.Duration("WEBHOOK_TIMEOUT", 10*time.Second)),
+		path:        path,
+		maxAttempts: config.Int("WEBHOOK_MAX_ATTEMPTS", 5),
+		baseDelay:   config.Duration("WEBHOOK_RETRY_BASE_DELAY", 5*time.Second),
+		maxDelay:    5 * time.Minute,
+		closing:     make(chan struct{}),
+		subs:        make(map[string]*subscription),
+		logs:        make(map[string]*deliveryLog),
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Create subscribes the caller to events. A secret is generated when none
+// is given; the returned webhook is the only place it is shown. Anonymous
+// callers can't subscribe.
+func (d *Dispatcher) Create(ctx context.Context, hook models.Webhook) (models.Webhook, error) {
+	user := auth.UserFromContext(ctx)
+	if user == "" {
+		return models.Webhook{}, ErrAnonymous
+	}
+	if err := validate(ctx, &hook); err != nil {
+		return models.Webhook{}, err
+	}
+	hook.ID = uuid.New().String()
+	hook.CreatedAt = time.Now()
+	if hook.Secret == "" {
+		hook.Secret = newSecret()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.subs[hook.ID] = &subscription{Webhook: hook, Owner: user}
+	if err := d.save(); err != nil {
+		delete(d.subs, hook.ID)
+		return models.Webhook{}, err
+	}
+	logger.Log.WithFields(map[string]interface{}{
+		"webhookID": hook.ID,
+		"url":       hook.URL,
+	}).Info("Webhook created")
+	return hook, nil
+}
+
+// List returns the caller's subscriptions, without their secrets.
+func (d *Dispatcher) List(ctx context.Context) []models.Webhook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hooks := []models.Webhook{}
+	for _, sub := range d.subs {
+		if sub.Owner == auth.UserFromContext(ctx) {
+			hook := sub.Webhook
+			hook.Secret = ""
+			hooks = append(hooks, hook)
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].CreatedAt.Before(hooks[j].CreatedAt)
+	})
+	return hooks
+}
+
+func (d *Dispatcher) Delete(ctx context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sub, ok := d.subs[id]
+	if !ok || sub.Owner != auth.UserFromContext(ctx) {
+		return ErrNotFound
+	}
+	delete(d.subs, id)
+	if err := d.save(); err != nil {
+		d.subs[id] = sub
+		return err
+	}
+	delete(d.logs, id)
+	logger.Log.WithField("webhookID", id).Info("Webhook deleted")
+	return nil
+}
+
+// NewJobWebhook validates the webhook given with a job and assigns it an
+// ID. Job webhooks must bring their own secret, since it is never shown
+// back.
+func NewJobWebhook(ctx context.Context, hook models.Webhook) (*models.Webhook, error) {
+	if hook.Secret == "" {
+		return nil, errors.New("webhook secret is required")
+	}
+	if err := validate(ctx, &hook); err != nil {
+		return nil, err
+	}
+	hook.ID = uuid.New().String()
+	hook.CreatedAt = time.Now()
+	return &hook, nil
+}
+
+// Publish sends an event to every subscription of owner that wants it, and
+// to extra, a job's own webhook, if given. Events of anonymous callers only
+// go to extra. Delivery happens in the background.
+func (d *Dispatcher) Publish(owner string, extra *models.Webhook, eventType string, data interface{}) {
+	event := models.WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: time.Now(),
+		Data:      data,
+	}
+
+	d.mu.Lock()
+	var targets []models.Webhook
+	for _, sub := range d.subs {
+		if owner != "" && sub.Owner == owner && wants(sub.Webhook, eventType) {
+			targets = append(targets, sub.Webhook)
+		}
+	}
+	if extra != nil && wants(*extra, eventType) {
+		targets = append(targets, *extra)
+	}
+	d.mu.Unlock()
+
+	if len(targets) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		logger.Log.WithError(err).WithField("event", eventType).Error("Failed to encode webhook event")
+		return
+	}
+	for _, hook := range targets {
+		d.deliveries.Add(1)
+		d.pending.Add(1)
+		go func() {
+			defer d.deliveries.Done()
+			defer d.pending.Add(-1)
+			d.deliver(owner, hook, event, body)
+		}()
+	}
+}
+
+// Shutdown lets the delivery attempts under way finish, without further
+// retries, until ctx is done; then it aborts them. Events published
+// afterwards are still attempted once.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	close(d.closing)
+
+	done := make(chan struct{})
+	go func() {
+		d.deliveries.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	if d.pending.Load() == 0 {
+		// Every delivery had returned by the deadline.
+		<-done
+		return nil
+	}
+	d.cancel()
+	<-done
+	return fmt.Errorf("webhook deliveries aborted: %w", ctx.Err())
+}
+
+// validate checks the URL and event types of a webhook given by a caller.
+// The URL must use https and resolve to public addresses unless its host
+// is listed in WEBHOOK_ALLOWED_HOSTS.
+func validate(ctx context.Context, hook *models.Webhook) error {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook url must be an absolute http or https URL")
+	}
+	if err := allowedDestinations().checkURL(ctx, u); err != nil {
+		return err
+	}
+	for _, event := range hook.Events {
+		if !slices.Contains(events, event) {
+			return fmt.Errorf("unknown webhook event %q", event)
+		}
+	}
+	return nil
+}
+
+func wants(hook models.Webhook, eventType string) bool {
+	return len(hook.Events) == 0 || slices.Contains(hook.Events, eventType)
+}
+
+func newSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+func (d *Dispatcher) load() error {
+	data, err := os.ReadFile(d.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read webhooks file: %w", err)
+	}
+
+	var subs []*subscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		return fmt.Errorf("invalid webhooks file %s: %w", d.path, err)
+	}
+	for _, sub := range subs {
+		if sub.Owner == "" {
+			// Left from when anonymous callers could subscribe.
+			logger.Log.WithField("webhookID", sub.ID).Warn("Dropping webhook subscription without an owner")
+			continue
+		}
+		d.subs[sub.ID] = sub
+	}
+	logger.Log.WithField("webhooks", len(d.subs)).Info("Loaded webhook subscriptions")
+	return nil
+}
+
+// save writes every subscription to WEBHOOKS_FILE atomically. Callers must
+// hold d.mu.
+func (d *Dispatcher) save() error {
+	subs := make([]*subscription, 0, len(d.subs))
+	for _, sub := range d.subs {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].CreatedAt.Before(subs[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(subs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(d.path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create webhooks directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".webhooks-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path)
+}
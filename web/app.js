@@ -9,6 +9,11 @@ class ChatApp {
         this.loadFromLocalStorage();
         this.bindEvents();
         this.renderMessages();
+        this.updateDownloadAll();
+        
+        // Scheduled prompts deliver their results to the session as jobs.
+        this.fetchJobResults();
+        setInterval(() => this.fetchJobResults(), 60000);
     }
     
     initializeElements() {
@@ -20,10 +25,18 @@ class ChatApp {
         this.contextSizeEl = document.getElementById('context-size');
         this.contextCountEl = document.getElementById('context-count');
         
+        this.downloadAllEl = document.getElementById('download-all');
+        
         this.sessionIdEl.textContent = `Session: ${this.sessionId.slice(0, 8)}...`;
         this.contextSizeEl.value = this.contextWindowSize;
     }
     
+    updateDownloadAll() {
+        const hasFiles = this.messages.some(m => m.files && m.files.length > 0);
+        this.downloadAllEl.href = `/api/sessions/${this.sessionId}/files.zip`;
+        this.downloadAllEl.style.display = hasFiles ? '' : 'none';
+    }
+    
     bindEvents() {
         this.sendBtn.addEventListener('click', () => this.sendMessage());
         this.inputEl.addEventListener('keydown', (e) => {
@@ -132,10 +145,17 @@ class ChatApp {
             
             const data = await response.json();
             
-            if (data.error) {
+            if (data.status === 'timed_out') {
+                // Keep what was produced before the deadline.
+                data.message.content = (data.message.content ? data.message.content + '\n\n' : '') +
+                    `_${data.error}_ (Response cut off.)`;
+            } else if (data.error) {
                 throw new Error(data.error);
             }
             
+            if (data.skippedFiles) {
+                data.message.skippedFiles = data.skippedFiles;
+            }
             this.messages.push(data.message);
             this.renderMessage(data.message);
             
@@ -154,10 +174,38 @@ class ChatApp {
             this.inputEl.disabled = false;
             this.inputEl.focus();
             this.updateContextWindow();
+            this.updateDownloadAll();
             this.saveToLocalStorage();
         }
     }
     
+    async fetchJobResults() {
+        try {
+            const response = await fetch(`/api/sessions/${this.sessionId}/jobs`);
+            if (!response.ok) return;
+            const jobs = await response.json();
+            
+            const known = new Set(this.messages.map(m => m.id));
+            let added = false;
+            jobs.forEach(job => {
+                if (job.status !== 'completed' || !job.response) return;
+                const message = job.response.message;
+                if (!message || known.has(message.id)) return;
+                this.messages.push(message);
+                this.renderMessage(message);
+                added = true;
+            });
+            
+            if (added) {
+                this.updateContextWindow();
+                this.updateDownloadAll();
+                this.saveToLocalStorage();
+            }
+        } catch (error) {
+            console.error('Failed to fetch job results:', error);
+        }
+    }
+    
     renderMessages() {
         this.messagesEl.innerHTML = '';
         this.messages.forEach(msg => this.renderMessage(msg));
@@ -188,6 +236,10 @@ class ChatApp {
             messageEl.appendChild(filesEl);
         }
         
+        if (message.skippedFiles && message.skippedFiles.length > 0) {
+            messageEl.appendChild(this.renderSkippedFiles(message.skippedFiles));
+        }
+        
         this.messagesEl.appendChild(messageEl);
         
         Prism.highlightAllUnder(messageEl);
@@ -203,18 +255,34 @@ class ChatApp {
             const fileEl = document.createElement('div');
             fileEl.className = 'file-item';
             
-            const fileUrl = `/api/files/${this.sessionId}/${file.name}`;
+            const filePath = file.name.split('/').map(encodeURIComponent).join('/');
+            const params = new URLSearchParams();
+            if (file.version) {
+                params.set('version', file.version);
+            }
+            const query = params.toString();
+            const fileUrl = `/api/files/${this.sessionId}/${filePath}` + (query ? `?${query}` : '');
             
             if (file.mimeType.startsWith('image/')) {
+                // Chat history shows a scaled rendition linking to the original
+                params.set('size', 'medium');
+                const previewUrl = `/api/files/${this.sessionId}/${filePath}?${params}`;
                 const preview = document.createElement('div');
                 preview.className = 'file-preview';
-                preview.innerHTML = `<img src="${fileUrl}" alt="${file.name}">`;
+                preview.innerHTML = `<a href="${fileUrl}" target="_blank" rel="noopener"><img src="${previewUrl}" alt="${file.name}" loading="lazy"></a>`;
                 fileEl.appendChild(preview);
+            } else if (file.previewable && file.mimeType === 'application/pdf') {
+                const preview = document.createElement('div');
+                preview.className = 'file-preview';
+                preview.innerHTML = `<iframe src="${fileUrl}" title="${file.name}"></iframe>`;
+                fileEl.appendChild(preview);
+            } else if (file.previewable) {
+                fileEl.appendChild(this.renderTextPreview(fileUrl, file));
             }
             
             const link = document.createElement('a');
             link.href = fileUrl;
-            link.download = file.name;
+            link.download = file.name.split('/').pop();
             link.className = 'download-link';
             link.textContent = `Download ${file.name}`;
             fileEl.appendChild(link);
@@ -225,6 +293,39 @@ class ChatApp {
         return filesContainer;
     }
     
+    renderSkippedFiles(skipped) {
+        const skippedEl = document.createElement('div');
+        skippedEl.className = 'skipped-files';
+        skippedEl.textContent = 'Not returned: ' + skipped
+            .map(f => `${f.name} (${f.reason.replace(/_/g, ' ')})`)
+            .join(', ');
+        return skippedEl;
+    }
+    
+    renderTextPreview(fileUrl, file) {
+        const preview = document.createElement('div');
+        preview.className = 'file-preview text-preview';
+
+        const pre = document.createElement('pre');
+        const code = document.createElement('code');
+        if (file.language) {
+            code.className = `language-${file.language}`;
+        }
+        pre.appendChild(code);
+        preview.appendChild(pre);
+
+        fetch(fileUrl)
+            .then(response => response.ok ? response.text() : Promise.reject(response.statusText))
+            .then(text => {
+                // Text is inserted as textContent, never parsed as HTML
+                code.textContent = text;
+                Prism.highlightElement(code);
+            })
+            .catch(() => preview.remove());
+
+        return preview;
+    }
+    
     showTypingIndicator() {
         const indicator = document.createElement('div');
         indicator.id = 'typing-indicator';
@@ -249,6 +350,7 @@ class ChatApp {
             this.sessionIdEl.textContent = `Session: ${this.sessionId.slice(0, 8)}...`;
             this.saveToLocalStorage();
             this.renderMessages();
+            this.updateDownloadAll();
         }
     }
 }